@@ -0,0 +1,509 @@
+// Package client is a typed Go client for the Pluto HTTP API described by core/openapi.json
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the API of a Pluto server
+type Client struct {
+	BaseURL    string       // Server address such as http://localhost:8081
+	HTTPClient *http.Client // Client used for requests and its TLS settings, http.DefaultClient when nil
+	Token      string       // API token sent as a bearer token with every request, issued with "pluto token issue"
+}
+
+// New returns a client for the server at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// Error is returned for every response outside the 2xx range
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("pluto: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// DeviceFilter narrows ListDevices, empty fields match every device
+type DeviceFilter struct {
+	Status string  // Maintenance level such as due or overdue
+	Model  *string // Model name, a pointer to "" matches devices without a model
+}
+
+// LogQuery selects a page of the event log, zero fields are not filtered on
+type LogQuery struct {
+	DeviceIP string
+	Action   string // increment matches every increment+N action
+	From     time.Time
+	To       time.Time
+	Response *int
+	Cursor   int64 // NextCursor of the previous page
+	Limit    int
+}
+
+// Reload makes the server reload its state from the database and returns its summary
+func (c *Client) Reload(ctx context.Context) (string, error) {
+	resp, err := c.send(ctx, http.MethodPost, "/reload", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	summary, err := io.ReadAll(resp.Body)
+	return string(summary), err
+}
+
+func (c *Client) ListDevices(ctx context.Context, filter DeviceFilter) ([]DeviceStatus, error) {
+	query := url.Values{}
+	if filter.Status != "" {
+		query.Set("status", filter.Status)
+	}
+	if filter.Model != nil {
+		query.Set("model", *filter.Model)
+	}
+
+	var statuses []DeviceStatus
+	err := c.do(ctx, http.MethodGet, withQuery("/api/v1/devices", query), nil, &statuses)
+	return statuses, err
+}
+
+func (c *Client) GetDevice(ctx context.Context, ip string) (DeviceStatus, error) {
+	var status DeviceStatus
+	err := c.do(ctx, http.MethodGet, "/api/v1/devices/"+url.PathEscape(ip), nil, &status)
+	return status, err
+}
+
+// ImportDevices pre-registers the devices of a CSV file with a header row out of ip, serial, model, site,
+// current_count and total_count. Invalid rows are reported in the result together with an *Error of status 400.
+func (c *Client) ImportDevices(ctx context.Context, csv io.Reader, dryRun bool) (ImportResult, error) {
+	path := "/api/v1/devices/import"
+	if dryRun {
+		path += "?dry_run=true"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, csv)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	req.Header.Set("Content-Type", "text/csv")
+	c.authorize(req)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer resp.Body.Close()
+
+	var result ImportResult
+	if resp.StatusCode == http.StatusBadRequest && strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return ImportResult{}, fmt.Errorf("pluto: failed to decode response: %w", err)
+		}
+		return result, &Error{StatusCode: resp.StatusCode, Message: fmt.Sprintf("%d invalid rows", len(result.Errors))}
+	}
+	if err := checkStatus(resp); err != nil {
+		return ImportResult{}, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return ImportResult{}, fmt.Errorf("pluto: failed to decode response: %w", err)
+	}
+	return result, nil
+}
+
+// DecommissionDevice retires a device, it keeps its history but gets no replies and is left out of stats. An empty
+// actor is recorded as the name of the client's token.
+func (c *Client) DecommissionDevice(ctx context.Context, ip, actor, reason string) (Device, error) {
+	body := map[string]string{"actor": actor, "reason": reason}
+
+	var device Device
+	err := c.do(ctx, http.MethodPost, "/api/v1/devices/"+url.PathEscape(ip)+"/decommission", body, &device)
+	return device, err
+}
+
+// PurgeDevice deletes a device together with its logs and history
+func (c *Client) PurgeDevice(ctx context.Context, ip, actor, reason string) error {
+	body := map[string]string{"actor": actor, "reason": reason}
+	return c.do(ctx, http.MethodDelete, "/api/v1/devices/"+url.PathEscape(ip), body, nil)
+}
+
+// ListAudit lists the audit entries of ip, or of every device when it is empty
+func (c *Client) ListAudit(ctx context.Context, ip string) ([]AuditEntry, error) {
+	query := url.Values{}
+	if ip != "" {
+		query.Set("device", ip)
+	}
+
+	var entries []AuditEntry
+	err := c.do(ctx, http.MethodGet, withQuery("/api/v1/audit", query), nil, &entries)
+	return entries, err
+}
+
+// SetDeviceThreshold sets the threshold override of a device, 0 restores the model or global threshold
+func (c *Client) SetDeviceThreshold(ctx context.Context, ip string, threshold int) (Device, error) {
+	body := map[string]int{"threshold": threshold}
+
+	var device Device
+	err := c.do(ctx, http.MethodPut, devicePath(ip, "threshold"), body, &device)
+	return device, err
+}
+
+// AssignDeviceModel assigns a device model, an empty name unassigns it
+func (c *Client) AssignDeviceModel(ctx context.Context, ip, model string) (Device, error) {
+	body := map[string]string{"model": model}
+
+	var device Device
+	err := c.do(ctx, http.MethodPut, devicePath(ip, "model"), body, &device)
+	return device, err
+}
+
+// AssignDeviceSite moves a device to a site, an empty site leaves it to admins
+func (c *Client) AssignDeviceSite(ctx context.Context, ip, site string) (Device, error) {
+	body := map[string]string{"site": site}
+
+	var device Device
+	err := c.do(ctx, http.MethodPut, devicePath(ip, "site"), body, &device)
+	return device, err
+}
+
+// RecordMaintenance records a maintenance operation and returns the device after its count was reset
+func (c *Client) RecordMaintenance(ctx context.Context, ip string, record MaintenanceRecord) (Device, error) {
+	var device Device
+	err := c.do(ctx, http.MethodPost, devicePath(ip, "maintenance"), record, &device)
+	return device, err
+}
+
+func (c *Client) MaintenanceTimeline(ctx context.Context, ip string) (MaintenanceTimeline, error) {
+	var timeline MaintenanceTimeline
+	err := c.do(ctx, http.MethodGet, devicePath(ip, "maintenance"), nil, &timeline)
+	return timeline, err
+}
+
+func (c *Client) ListExemptions(ctx context.Context, ip string) ([]LockoutExemption, error) {
+	var exemptions []LockoutExemption
+	err := c.do(ctx, http.MethodGet, devicePath(ip, "exemptions"), nil, &exemptions)
+	return exemptions, err
+}
+
+func (c *Client) GrantExemption(ctx context.Context, ip string, exemption LockoutExemption) (LockoutExemption, error) {
+	err := c.do(ctx, http.MethodPost, devicePath(ip, "exemptions"), exemption, &exemption)
+	return exemption, err
+}
+
+func (c *Client) RevokeExemption(ctx context.Context, ip string) error {
+	return c.do(ctx, http.MethodDelete, devicePath(ip, "exemptions"), nil, nil)
+}
+
+func (c *Client) ListDeferrals(ctx context.Context, ip string) ([]MaintenanceDeferral, error) {
+	var deferrals []MaintenanceDeferral
+	err := c.do(ctx, http.MethodGet, devicePath(ip, "deferrals"), nil, &deferrals)
+	return deferrals, err
+}
+
+func (c *Client) DeferMaintenance(ctx context.Context, ip string, deferral MaintenanceDeferral) (MaintenanceDeferral, error) {
+	err := c.do(ctx, http.MethodPost, devicePath(ip, "deferrals"), deferral, &deferral)
+	return deferral, err
+}
+
+func (c *Client) CancelDeferral(ctx context.Context, ip string) error {
+	return c.do(ctx, http.MethodDelete, devicePath(ip, "deferrals"), nil, nil)
+}
+
+func (c *Client) ListModels(ctx context.Context) ([]DeviceModel, error) {
+	var models []DeviceModel
+	err := c.do(ctx, http.MethodGet, "/models", nil, &models)
+	return models, err
+}
+
+// SaveModel creates or updates the model named model.Name
+func (c *Client) SaveModel(ctx context.Context, model DeviceModel) (DeviceModel, error) {
+	err := c.do(ctx, http.MethodPut, "/models/"+url.PathEscape(model.Name), model, &model)
+	return model, err
+}
+
+func (c *Client) DeleteModel(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/models/"+url.PathEscape(name), nil, nil)
+}
+
+// ListForecasts projects threshold dates from the last windowDays of firing history, 0 uses the server default
+func (c *Client) ListForecasts(ctx context.Context, windowDays int) ([]Forecast, error) {
+	query := url.Values{}
+	if windowDays != 0 {
+		query.Set("window_days", strconv.Itoa(windowDays))
+	}
+
+	var forecasts []Forecast
+	err := c.do(ctx, http.MethodGet, withQuery("/forecasts", query), nil, &forecasts)
+	return forecasts, err
+}
+
+// ListWorkOrders lists work orders, empty status and ip match every order
+func (c *Client) ListWorkOrders(ctx context.Context, status, ip string) ([]WorkOrder, error) {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+	if ip != "" {
+		query.Set("device", ip)
+	}
+
+	var orders []WorkOrder
+	err := c.do(ctx, http.MethodGet, withQuery("/work-orders", query), nil, &orders)
+	return orders, err
+}
+
+func (c *Client) GetWorkOrder(ctx context.Context, id int64) (WorkOrder, error) {
+	var order WorkOrder
+	err := c.do(ctx, http.MethodGet, workOrderPath(id, ""), nil, &order)
+	return order, err
+}
+
+func (c *Client) AssignWorkOrder(ctx context.Context, id int64, assignee string) (WorkOrder, error) {
+	body := map[string]string{"assignee": assignee}
+
+	var order WorkOrder
+	err := c.do(ctx, http.MethodPost, workOrderPath(id, "assign"), body, &order)
+	return order, err
+}
+
+func (c *Client) StartWorkOrder(ctx context.Context, id int64) (WorkOrder, error) {
+	var order WorkOrder
+	err := c.do(ctx, http.MethodPost, workOrderPath(id, "start"), nil, &order)
+	return order, err
+}
+
+// CompleteWorkOrder completes an order and records the maintenance that resolved it
+func (c *Client) CompleteWorkOrder(ctx context.Context, id int64, record MaintenanceRecord) (WorkOrder, error) {
+	var order WorkOrder
+	err := c.do(ctx, http.MethodPost, workOrderPath(id, "complete"), record, &order)
+	return order, err
+}
+
+func (c *Client) ListLogs(ctx context.Context, q LogQuery) (LogPage, error) {
+	query := url.Values{}
+	if q.DeviceIP != "" {
+		query.Set("device", q.DeviceIP)
+	}
+	if q.Action != "" {
+		query.Set("action", q.Action)
+	}
+	if !q.From.IsZero() {
+		query.Set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		query.Set("to", q.To.Format(time.RFC3339))
+	}
+	if q.Response != nil {
+		query.Set("response", strconv.Itoa(*q.Response))
+	}
+	if q.Cursor != 0 {
+		query.Set("cursor", strconv.FormatInt(q.Cursor, 10))
+	}
+	if q.Limit != 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	var page LogPage
+	err := c.do(ctx, http.MethodGet, withQuery("/api/v1/logs", query), nil, &page)
+	return page, err
+}
+
+func (c *Client) GetStats(ctx context.Context) (FleetStats, error) {
+	var stats FleetStats
+	err := c.do(ctx, http.MethodGet, "/api/v1/stats", nil, &stats)
+	return stats, err
+}
+
+func (c *Client) GetSettings(ctx context.Context) (Settings, error) {
+	var settings Settings
+	err := c.do(ctx, http.MethodGet, "/api/v1/settings", nil, &settings)
+	return settings, err
+}
+
+// SetThreshold changes the global threshold of the server
+func (c *Client) SetThreshold(ctx context.Context, threshold int) (ThresholdChange, error) {
+	body := map[string]int{"threshold": threshold}
+
+	var change ThresholdChange
+	err := c.do(ctx, http.MethodPut, "/api/v1/settings/threshold", body, &change)
+	return change, err
+}
+
+// ClearThreshold deletes the threshold set at runtime, the server returns to the one it was started with
+func (c *Client) ClearThreshold(ctx context.Context) (ThresholdChange, error) {
+	var change ThresholdChange
+	err := c.do(ctx, http.MethodDelete, "/api/v1/settings/threshold", nil, &change)
+	return change, err
+}
+
+// Rekey re-encrypts the database of the server with a new key, with keepBackup the original is kept next to it. The
+// server only accepts the key over HTTPS or from localhost.
+func (c *Client) Rekey(ctx context.Context, newKey string, keepBackup bool) (RekeyResult, error) {
+	body := map[string]any{"new_key": newKey, "keep_backup": keepBackup}
+
+	var result RekeyResult
+	err := c.do(ctx, http.MethodPost, "/api/v1/database/rekey", body, &result)
+	return result, err
+}
+
+// Export streams a dataset (devices, logs or maintenance) in format csv or ndjson, zero from and to export every row.
+// The caller closes the returned body.
+func (c *Client) Export(ctx context.Context, dataset, format string, from, to time.Time) (io.ReadCloser, error) {
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339))
+	}
+
+	resp, err := c.send(ctx, http.MethodGet, withQuery("/api/v1/export/"+url.PathEscape(dataset), query), nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// StreamEvents subscribes to live events of ip, or of every device when it is empty. The channel is closed when ctx
+// is cancelled or the server ends the stream.
+func (c *Client) StreamEvents(ctx context.Context, ip string) (<-chan Event, error) {
+	query := url.Values{}
+	if ip != "" {
+		query.Set("device", ip)
+	}
+
+	resp, err := c.send(ctx, http.MethodGet, withQuery("/api/v1/events", query), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// do sends a request with an optional JSON body and decodes the JSON response into out unless it is nil
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("pluto: failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("pluto: failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// send performs a request and turns responses outside the 2xx range into an *Error
+func (c *Client) send(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.authorize(req)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (c *Client) authorize(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// checkStatus turns a response outside the 2xx range into an *Error holding the server's message
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	message, _ := io.ReadAll(resp.Body)
+	return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+}
+
+func devicePath(ip, resource string) string {
+	return "/devices/" + url.PathEscape(ip) + "/" + resource
+}
+
+func workOrderPath(id int64, action string) string {
+	path := "/work-orders/" + strconv.FormatInt(id, 10)
+	if action != "" {
+		path += "/" + action
+	}
+	return path
+}
+
+func withQuery(path string, query url.Values) string {
+	if len(query) == 0 {
+		return path
+	}
+	return path + "?" + query.Encode()
+}
@@ -0,0 +1,195 @@
+package client
+
+import "time"
+
+// The types below mirror the schemas of core/openapi.json. They are kept separate from the core package so that
+// tools built on the client do not link the database driver.
+
+type Device struct {
+	IP           string    `json:"ip"`
+	Serial       string    `json:"serial"`
+	CurrentCount int       `json:"current_count"` // Trigger count since the last maintenance
+	TotalCount   int       `json:"total_count"`   // Trigger count since deployment
+	LastSeen     time.Time `json:"last_seen"`
+	RegisteredAt time.Time `json:"registered_at"`
+	Threshold    int       `json:"threshold"` // Device specific threshold, 0 falls back to the model or global threshold
+	Model        string    `json:"model"`
+	Site         string    `json:"site"`
+
+	LastMaintenance time.Time `json:"last_maintenance"`
+	ExemptUntil     time.Time `json:"exempt_until"`
+
+	Deferral *MaintenanceDeferral `json:"deferral"`
+
+	DecommissionedAt time.Time `json:"decommissioned_at"` // Zero while in service
+}
+
+// DeviceStatus is a device together with its computed maintenance status
+type DeviceStatus struct {
+	Device
+	EffectiveThreshold int        `json:"effective_threshold"`
+	Status             string     `json:"status"` // normal, approaching, due, overdue or lockout
+	PercentUsed        float64    `json:"percent_used"`
+	LastSeenAgeSeconds int64      `json:"last_seen_age_seconds"`
+	DueDate            *time.Time `json:"due_date"`
+	LifetimeExceeded   bool       `json:"lifetime_exceeded"`
+}
+
+// MaintenanceRecord is a maintenance operation, only Technician, Kind and Notes are read when recording one
+type MaintenanceRecord struct {
+	ID           int64     `json:"id"`
+	DeviceIP     string    `json:"device_ip"`
+	PerformedAt  time.Time `json:"performed_at"`
+	CountAtReset int       `json:"count_at_reset"`
+	Technician   string    `json:"technician"`
+	Kind         string    `json:"kind"` // routine (default), repair, replacement or inspection
+	Notes        string    `json:"notes"`
+}
+
+type MaintenanceTimeline struct {
+	IP           string              `json:"ip"`
+	RegisteredAt time.Time           `json:"registered_at"`
+	CurrentCount int                 `json:"current_count"`
+	TotalCount   int                 `json:"total_count"`
+	Records      []MaintenanceRecord `json:"records"`
+}
+
+// LockoutExemption lets a device keep operating past the lockout margin, GrantedBy, Reason and ExpiresAt are required
+type LockoutExemption struct {
+	ID        int64      `json:"id"`
+	DeviceIP  string     `json:"device_ip"`
+	GrantedBy string     `json:"granted_by"`
+	Reason    string     `json:"reason"`
+	GrantedAt time.Time  `json:"granted_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// MaintenanceDeferral postpones maintenance replies, DeferredBy, Reason and Until or ExtraTriggers are required
+type MaintenanceDeferral struct {
+	ID              int64      `json:"id"`
+	DeviceIP        string     `json:"device_ip"`
+	DeferredBy      string     `json:"deferred_by"`
+	Reason          string     `json:"reason"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Until           *time.Time `json:"until"`
+	ExtraTriggers   int        `json:"extra_triggers"`
+	CountAtDeferral int        `json:"count_at_deferral"`
+	EndedAt         *time.Time `json:"ended_at"`
+	EndReason       string     `json:"end_reason"` // expired, cancelled, replaced or maintenance once ended
+}
+
+type DeviceModel struct {
+	Name           string `json:"name"`
+	Threshold      int    `json:"threshold"`
+	WarningPercent int    `json:"warning_percent"`
+	LifetimeLimit  int    `json:"lifetime_limit"`
+	IntervalDays   int    `json:"interval_days"`
+}
+
+type Forecast struct {
+	IP            string     `json:"ip"`
+	CurrentCount  int        `json:"current_count"`
+	Threshold     int        `json:"threshold"`
+	DailyRate     float64    `json:"daily_rate"`
+	DaysRemaining *float64   `json:"days_remaining"` // nil for idle devices
+	ProjectedDate *time.Time `json:"projected_date"` // nil for idle devices
+}
+
+type WorkOrder struct {
+	ID            int64     `json:"id"`
+	DeviceIP      string    `json:"device_ip"`
+	Status        string    `json:"status"` // open, assigned, in_progress or completed
+	Reason        string    `json:"reason"` // threshold or calendar
+	CountAtOpen   int       `json:"count_at_open"`
+	Assignee      string    `json:"assignee"`
+	OpenedAt      time.Time `json:"opened_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	MaintenanceID int64     `json:"maintenance_id"`
+}
+
+type LogEntry struct {
+	ID         int64     `json:"id"`
+	DeviceIP   string    `json:"device_ip"`
+	Action     string    `json:"action"`
+	CountValue int       `json:"count_value"`
+	Timestamp  time.Time `json:"timestamp"`
+	Response   int       `json:"response"`
+}
+
+type LogPage struct {
+	Entries    []LogEntry `json:"entries"`
+	NextCursor int64      `json:"next_cursor"` // 0 on the last page
+}
+
+type FleetStats struct {
+	GeneratedAt       time.Time      `json:"generated_at"`
+	TotalDevices      int            `json:"total_devices"`
+	Decommissioned    int            `json:"decommissioned"`
+	ActiveDevices     int            `json:"active_devices"`
+	BelowThreshold    int            `json:"below_threshold"`
+	AboveThreshold    int            `json:"above_threshold"`
+	PastLifetimeLimit int            `json:"past_lifetime_limit"`
+	TotalCurrentCount int            `json:"total_current_count"`
+	GrandTotalCount   int            `json:"grand_total_count"`
+	ByStatus          map[string]int `json:"by_status"`
+	ByActivity        map[string]int `json:"by_activity"`
+}
+
+type Settings struct {
+	Threshold      int `json:"threshold"`
+	WarningPercent int `json:"warning_percent"`
+	GraceMargin    int `json:"grace_margin"`
+	LockoutMargin  int `json:"lockout_margin"`
+	IntervalDays   int `json:"interval_days"`
+}
+
+// ThresholdChange reports a runtime threshold update, NewlyDue lists the devices that got a work order
+type ThresholdChange struct {
+	Previous  int      `json:"previous"`
+	Threshold int      `json:"threshold"`
+	NewlyDue  []string `json:"newly_due"`
+}
+
+// RekeyResult reports a database key rotation, Backup names the original when it was kept
+type RekeyResult struct {
+	Tables int    `json:"tables"`
+	Rows   int    `json:"rows"`
+	Backup string `json:"backup"`
+}
+
+// ImportResult reports a device import, nothing is registered when Errors is not empty
+type ImportResult struct {
+	DryRun  bool          `json:"dry_run"`
+	Devices []Device      `json:"devices"`
+	Errors  []ImportError `json:"errors"`
+}
+
+type ImportError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// AuditEntry records an administrative operation on a device
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"` // decommission or purge
+	DeviceIP  string    `json:"device_ip"`
+	Actor     string    `json:"actor"`
+	Details   string    `json:"details"`
+}
+
+// Event is a live change streamed by the server, fields that do not apply to the event type are empty
+type Event struct {
+	Type           string    `json:"type"` // startup, increment, threshold_crossing or reload
+	Time           time.Time `json:"time"`
+	DeviceIP       string    `json:"device_ip"`
+	CurrentCount   int       `json:"current_count"`
+	TotalCount     int       `json:"total_count"`
+	Increment      int       `json:"increment"`
+	Status         string    `json:"status"`
+	PreviousStatus string    `json:"previous_status"`
+	Response       int       `json:"response"`
+	Devices        int       `json:"devices"`
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	. "svrn.com/pluto/core"
+)
+
+// commands are the administrative subcommands run instead of the server, as in "pluto import devices.csv"
+var commands = map[string]func(args []string) error{
+	"import": runImport,
+	"export": runExport,
+	"token":  runToken,
+	"rekey":  runRekey,
+}
+
+// openDB opens the database of a stopped or running server for a subcommand
+func openDB(dbName string, dbKey func() (string, error)) (*PlutoServer, error) {
+	key, err := dbKey()
+	if err != nil {
+		return nil, err
+	}
+
+	server := &PlutoServer{Devices: make(map[string]*Device), DBKey: key}
+	if err := server.InitDB(dbName); err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %v", err)
+	}
+	return server, nil
+}
+
+// openServer opens the database and loads the devices of a stopped or running server for a subcommand
+func openServer(dbName string, dbKey func() (string, error), applyPolicy func(server *PlutoServer)) (*PlutoServer, error) {
+	server, err := openDB(dbName, dbKey)
+	if err != nil {
+		return nil, err
+	}
+	applyPolicy(server)
+	if err := server.LoadSettings(); err != nil {
+		server.Db.Close()
+		return nil, err
+	}
+	if err := server.LoadDevices(); err != nil {
+		server.Db.Close()
+		return nil, fmt.Errorf("failed to load devices: %v", err)
+	}
+	return server, nil
+}
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dbName := flags.String("db", "pluto.db", "Database file")
+	dryRun := flags.Bool("dry-run", false, "Validate the file without registering any device")
+	dbKey := dbKeyFlag(flags)
+	applyPolicy := policyFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: pluto import [-db pluto.db] [-dry-run] [policy flags] devices.csv")
+		fmt.Fprintln(flags.Output(), "Columns: ip (required), serial, model, site, current_count, total_count")
+		fmt.Fprintln(flags.Output(), "Pass the policy flags of the server so units that arrive due get a work order")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	server, err := openServer(*dbName, dbKey, applyPolicy)
+	if err != nil {
+		return err
+	}
+	defer server.Db.Close()
+
+	result, err := server.ImportDevices(file, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, importErr := range result.Errors {
+		fmt.Printf("line %d: %s\n", importErr.Line, importErr.Message)
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%d invalid rows, no device was imported", len(result.Errors))
+	}
+
+	for _, device := range result.Devices {
+		fmt.Printf("%s\tserial=%s\tmodel=%s\tcurrent=%d\ttotal=%d\n",
+			device.IP, device.Serial, device.Model, device.CurrentCount, device.TotalCount)
+	}
+	if *dryRun {
+		fmt.Printf("Dry run: %d devices would be imported\n", len(result.Devices))
+	} else {
+		fmt.Printf("Imported %d devices, reload a running server with POST /reload\n", len(result.Devices))
+	}
+	return nil
+}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	dbName := flags.String("db", "pluto.db", "Database file")
+	format := flags.String("format", ExportCSV, "Output format, csv or ndjson")
+	flags.String("from", "", "Earliest log or maintenance timestamp to export, RFC3339 (default: no limit)")
+	flags.String("to", "", "Export logs and maintenance before this RFC3339 timestamp (default: no limit)")
+	output := flags.String("o", "", "Output file (default: standard output)")
+	dbKey := dbKeyFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: pluto export [-db pluto.db] [-format csv|ndjson] [-from t] [-to t] [-o file] devices|logs|maintenance")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	q := ExportQuery{Dataset: flags.Arg(0), Format: *format}
+	for name, target := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		value := flags.Lookup(name).Value.String()
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("invalid -%s timestamp %q, expected RFC3339", name, value)
+		}
+		*target = t
+	}
+
+	server, err := openDB(*dbName, dbKey)
+	if err != nil {
+		return err
+	}
+	defer server.Db.Close()
+
+	out := os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	return server.Export(out, q)
+}
+
+func runToken(args []string) error {
+	flags := flag.NewFlagSet("token", flag.ExitOnError)
+	dbName := flags.String("db", "pluto.db", "Database file")
+	role := flags.String("role", RoleViewer, "Role of an issued token: viewer, technician or admin")
+	sites := flags.String("sites", "", "Comma separated sites serviced by an issued technician token")
+	dbKey := dbKeyFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: pluto token [-db pluto.db] [-role viewer|technician|admin] [-sites a,b] issue NAME | revoke NAME | list")
+		fmt.Fprintln(flags.Output(), "Issued tokens are sent to the HTTP API as \"Authorization: Bearer TOKEN\"")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	action := flags.Arg(0)
+	if !(action == "list" && flags.NArg() == 1) && !((action == "issue" || action == "revoke") && flags.NArg() == 2) {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	server, err := openDB(*dbName, dbKey)
+	if err != nil {
+		return err
+	}
+	defer server.Db.Close()
+
+	switch action {
+	case "issue":
+		var siteList []string
+		if *sites != "" {
+			siteList = strings.Split(*sites, ",")
+		}
+		token, _, err := server.IssueToken(flags.Arg(1), *role, siteList)
+		if err != nil {
+			return err
+		}
+		fmt.Println(token)
+		fmt.Fprintln(os.Stderr, "Store the token now, it cannot be shown again")
+	case "revoke":
+		return server.RevokeToken(flags.Arg(1))
+	case "list":
+		tokens, err := server.APITokens()
+		if err != nil {
+			return err
+		}
+		for _, token := range tokens {
+			lastUsed, state := "never", "active"
+			if token.LastUsedAt != nil {
+				lastUsed = token.LastUsedAt.Local().Format(time.DateTime)
+			}
+			if token.RevokedAt != nil {
+				state = "revoked " + token.RevokedAt.Local().Format(time.DateTime)
+			}
+			fmt.Printf("%s\trole=%s\tsites=%s\tcreated=%s\tlast_used=%s\t%s\n", token.Name, token.Role,
+				strings.Join(token.Sites, ","), token.CreatedAt.Local().Format(time.DateTime), lastUsed, state)
+		}
+	}
+	return nil
+}
+
+func runRekey(args []string) error {
+	flags := flag.NewFlagSet("rekey", flag.ExitOnError)
+	dbName := flags.String("db", "pluto.db", "Database file")
+	newKeyFile := flags.String("new-key-file", "", "File holding the new database key, readable by its owner only (default: $"+NewDBKeyEnv+" or a prompt)")
+	keepBackup := flags.Bool("keep-backup", false, "Keep the database encrypted with the old key as DB.old")
+	dbKey := dbKeyFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: pluto rekey [-db pluto.db] [-db-key-file old] [-new-key-file new] [-keep-backup]")
+		fmt.Fprintln(flags.Output(), "Re-encrypts a stopped server's database, use POST /api/v1/database/rekey on a running one")
+		fmt.Fprintln(flags.Output(), "It is refused while a server has the database open")
+		fmt.Fprintln(flags.Output(), "A database of an earlier version, which is not encrypted, is encrypted without an old key")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	// Databases of earlier versions are not encrypted and have no old key
+	plaintext, err := IsPlaintextDB(*dbName)
+	if err != nil {
+		return err
+	}
+	var oldKey string
+	if !plaintext {
+		if oldKey, err = dbKey(); err != nil {
+			return err
+		}
+	}
+	newKey, err := readNewKey(*newKeyFile)
+	if err != nil {
+		return err
+	}
+
+	result, err := RekeyDatabase(*dbName, oldKey, newKey, *keepBackup)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Re-encrypted %s: %d tables, %d rows\n", *dbName, result.Tables, result.Rows)
+	if result.Backup != "" {
+		fmt.Printf("The original, still encrypted with the old key, is %s\n", result.Backup)
+	}
+	fmt.Fprintln(os.Stderr, "Update -db-key-file or $"+DBKeyEnv+" with the new key before starting the server")
+	return nil
+}
+
+// readNewKey resolves the new key of a rekey from its file, the PLUTO_NEW_DB_KEY environment variable or two matching
+// prompts on the terminal, in that order
+func readNewKey(keyFile string) (string, error) {
+	if keyFile != "" {
+		return ReadDBKeyFile(keyFile)
+	}
+	if key := os.Getenv(NewDBKeyEnv); key != "" {
+		return key, nil
+	}
+
+	key, err := promptDBKey("New database key")
+	if err != nil {
+		return "", fmt.Errorf("no new database key: pass -new-key-file, set %s or enter it on a terminal (%v)", NewDBKeyEnv, err)
+	}
+	confirmed, err := promptDBKey("Repeat the new database key")
+	if err != nil {
+		return "", err
+	}
+	if confirmed != key {
+		return "", errors.New("the new database keys do not match")
+	}
+	return key, nil
+}
+
+// runCommand runs the subcommand named by the first argument and reports whether there was one
+func runCommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		return false
+	}
+
+	log.SetOutput(os.Stderr)
+	if err := command(os.Args[2:]); err != nil {
+		log.Fatalf("%s: %v", os.Args[1], err)
+	}
+	return true
+}
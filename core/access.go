@@ -0,0 +1,103 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Roles of API tokens, each role may do everything the roles before it may
+const (
+	RoleViewer     = "viewer"     // Reads device state
+	RoleTechnician = "technician" // Also records maintenance and works the orders of the units at its sites
+	RoleAdmin      = "admin"      // Also changes configuration, deletes devices and reloads the server
+)
+
+var roles = []string{RoleViewer, RoleTechnician, RoleAdmin}
+
+// roleRank orders roles by their permissions, unknown roles rank below every role
+func roleRank(role string) int {
+	return slices.Index(roles, role)
+}
+
+// callerKey stores the APIToken of an authenticated request in its context
+type callerKey struct{}
+
+// caller returns the token a request was authenticated with
+func caller(r *http.Request) (APIToken, bool) {
+	token, ok := r.Context().Value(callerKey{}).(APIToken)
+	return token, ok
+}
+
+// requireRole only lets requests through whose token has at least the given role
+func requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, _ := caller(r)
+		if roleRank(token.Role) < roleRank(role) {
+			forbidRequest(w, r, token, fmt.Sprintf("requires the %s role", role))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// services reports whether a token may work on a device. Technicians only service the units of their sites, units
+// without a site are left to admins.
+func (p *PlutoServer) services(token APIToken, deviceIP string) bool {
+	if token.Role == RoleAdmin {
+		return true
+	}
+	if token.Role != RoleTechnician {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, exists := p.Devices[deviceIP]
+	if !exists {
+		return true // Not found is reported by the operation itself
+	}
+	return device.Site != "" && slices.Contains(token.Sites, device.Site)
+}
+
+// requireSite only lets a request through whose token services the device, writing 403 otherwise
+func (p *PlutoServer) requireSite(w http.ResponseWriter, r *http.Request, deviceIP string) bool {
+	token, _ := caller(r)
+	if !p.services(token, deviceIP) {
+		forbidRequest(w, r, token, fmt.Sprintf("device %s is not at one of its sites", deviceIP))
+		return false
+	}
+	return true
+}
+
+func forbidRequest(w http.ResponseWriter, r *http.Request, token APIToken, reason string) {
+	log.Printf("Forbidden %s %s from %s (token %s): %s", r.Method, r.URL.Path, r.RemoteAddr, token.Name, reason)
+	http.Error(w, fmt.Sprintf("Forbidden: %s", reason), http.StatusForbidden)
+}
+
+// AssignSite moves a device to a site, an empty site leaves it to admins
+func (p *PlutoServer) AssignSite(deviceIP, site string) (Device, error) {
+	site = strings.TrimSpace(site)
+	if strings.Contains(site, ",") {
+		return Device{}, fmt.Errorf("%w: site names cannot contain commas", ErrInvalidInput)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, exists := p.Devices[deviceIP]
+	if !exists {
+		return Device{}, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceIP)
+	}
+
+	if _, err := p.Db.Exec("UPDATE devices SET site = ? WHERE ip = ?", site, deviceIP); err != nil {
+		return Device{}, fmt.Errorf("failed to save site for device %s: %v", deviceIP, err)
+	}
+	device.Site = site
+
+	log.Printf("Device %s assigned to site %q", deviceIP, site)
+	return *device, nil
+}
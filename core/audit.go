@@ -0,0 +1,67 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// Audited administrative operations
+const (
+	AuditDecommission = "decommission"
+	AuditPurge        = "purge"
+)
+
+// AuditEntry records an administrative operation on a device
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"` // One of the Audit values
+	DeviceIP  string    `json:"device_ip"`
+	Actor     string    `json:"actor"` // Person or client that requested the operation
+	Details   string    `json:"details"`
+}
+
+// audit appends an entry to the audit log, inside the transaction of the audited operation when db is one
+func audit(db execer, action, deviceIP, actor, details string) error {
+	query := `
+	INSERT INTO audit_log (timestamp, action, device_ip, actor, details)
+	VALUES (?, ?, ?, ?, ?)`
+
+	if _, err := db.Exec(query, formatTime(time.Now()), action, deviceIP, actor, details); err != nil {
+		return fmt.Errorf("failed to write audit entry for device %s: %v", deviceIP, err)
+	}
+	return nil
+}
+
+// AuditLog returns the audit entries of a device, or of every device when deviceIP is empty, oldest first
+func (p *PlutoServer) AuditLog(deviceIP string) ([]AuditEntry, error) {
+	query := "SELECT id, timestamp, action, device_ip, actor, details FROM audit_log"
+	var args []any
+	if deviceIP != "" {
+		query += " WHERE device_ip = ?"
+		args = append(args, deviceIP)
+	}
+	query += " ORDER BY id"
+
+	rows, err := p.Db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var timestamp string
+
+		err := rows.Scan(&entry.ID, &timestamp, &entry.Action, &entry.DeviceIP, &entry.Actor, &entry.Details)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %v", err)
+		}
+
+		entry.Timestamp = parseTime(timestamp)
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -2,20 +2,64 @@ package core
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	sqlite3 "github.com/mutecomm/go-sqlcipher/v4"
 )
 
+// execer is satisfied by both *sql.DB and *sql.Tx, so writes can join a transaction when needed
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// InitDB opens the database encrypted with p.DBKey and creates or migrates its schema. It refuses to open a database
+// without a key, with a wrong key or that is not encrypted.
 func (p *PlutoServer) InitDB(dbName string) error {
-	var err error
-	dbPath := fmt.Sprintf("%s?_crypto_key=%s", dbName, PlutoDBPassword)
-	p.Db, err = sql.Open("sqlite3", dbPath)
+	if p.DBKey == "" {
+		return ErrNoDBKey
+	}
+	plaintext, err := IsPlaintextDB(dbName)
 	if err != nil {
+		return err
+	}
+	if plaintext {
+		return fmt.Errorf("%w: %s, encrypt it with pluto rekey", ErrPlaintextDB, dbName)
+	}
+
+	return p.initDB(dbName)
+}
+
+// initDB opens the database with p.DBKey, which is only empty when an unencrypted database is converted by rekey
+func (p *PlutoServer) initDB(dbName string) error {
+	var err error
+	p.dbName = dbName
+	p.connector = &dbConnector{dsn: dbDSN(dbName, p.DBKey)}
+	p.Db = sql.OpenDB(p.connector)
+
+	// A wrong key only shows on the first read, the pages cannot be decrypted
+	if _, err = p.Db.Exec("SELECT COUNT(*) FROM sqlite_master"); err != nil {
+		p.Db.Close()
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrNotADB {
+			return fmt.Errorf("%w for %s", ErrWrongDBKey, dbName)
+		}
 		return fmt.Errorf("failed to open database: %v", err)
 	}
+	if p.dbFile, err = os.Stat(dbName); err != nil {
+		p.Db.Close()
+		return fmt.Errorf("failed to read database: %v", err)
+	}
 
 	// Create devices table with two count columns
 	createDevicesTable := `
@@ -24,7 +68,13 @@ func (p *PlutoServer) InitDB(dbName string) error {
 		current_count INTEGER NOT NULL DEFAULT 0,
 		total_count INTEGER NOT NULL DEFAULT 0,
 		last_seen DATETIME NOT NULL,
-		registered_at DATETIME NOT NULL
+		registered_at DATETIME NOT NULL,
+		threshold INTEGER NOT NULL DEFAULT 0,
+		model TEXT NOT NULL DEFAULT '',
+		last_maintenance DATETIME,
+		decommissioned_at DATETIME,
+		serial TEXT NOT NULL DEFAULT '',
+		site TEXT NOT NULL DEFAULT ''
 	);`
 
 	// Create logs table
@@ -39,41 +89,303 @@ func (p *PlutoServer) InitDB(dbName string) error {
 		FOREIGN KEY (device_ip) REFERENCES devices (ip)
 	);`
 
+	// Create maintenance records table, one row per completed maintenance operation
+	createMaintenanceTable := `
+	CREATE TABLE IF NOT EXISTS maintenance_records (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_ip TEXT NOT NULL,
+		performed_at DATETIME NOT NULL,
+		count_at_reset INTEGER NOT NULL,
+		technician TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		notes TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY (device_ip) REFERENCES devices (ip)
+	);`
+
+	// Create work orders table, opened when a device crosses the maintenance threshold
+	createWorkOrdersTable := `
+	CREATE TABLE IF NOT EXISTS work_orders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_ip TEXT NOT NULL,
+		status TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT 'threshold',
+		count_at_open INTEGER NOT NULL,
+		assignee TEXT NOT NULL DEFAULT '',
+		opened_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		maintenance_id INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (device_ip) REFERENCES devices (ip)
+	);`
+
+	// Create device models table, the maintenance policy of each laser unit hardware generation
+	createModelsTable := `
+	CREATE TABLE IF NOT EXISTS device_models (
+		name TEXT PRIMARY KEY,
+		threshold INTEGER NOT NULL,
+		warning_percent INTEGER NOT NULL DEFAULT 0,
+		lifetime_limit INTEGER NOT NULL DEFAULT 0,
+		interval_days INTEGER NOT NULL DEFAULT 0
+	);`
+
+	// Create lockout exemptions table, temporary permissions to operate past the lockout margin
+	createExemptionsTable := `
+	CREATE TABLE IF NOT EXISTS lockout_exemptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_ip TEXT NOT NULL,
+		granted_by TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		granted_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME,
+		FOREIGN KEY (device_ip) REFERENCES devices (ip)
+	);`
+
+	// Create maintenance deferrals table, supervisor approved postponements of maintenance replies
+	createDeferralsTable := `
+	CREATE TABLE IF NOT EXISTS maintenance_deferrals (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_ip TEXT NOT NULL,
+		deferred_by TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		until DATETIME,
+		extra_triggers INTEGER NOT NULL DEFAULT 0,
+		count_at_deferral INTEGER NOT NULL,
+		ended_at DATETIME,
+		end_reason TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY (device_ip) REFERENCES devices (ip)
+	);`
+
+	// Create settings table, server wide values changed at runtime that take precedence over the flags
+	createSettingsTable := `
+	CREATE TABLE IF NOT EXISTS settings (
+		name TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at DATETIME NOT NULL
+	);`
+
+	// Create audit log table, administrative operations on devices. It outlives purged devices, so it has no
+	// foreign key.
+	createAuditTable := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME NOT NULL,
+		action TEXT NOT NULL,
+		device_ip TEXT NOT NULL,
+		actor TEXT NOT NULL,
+		details TEXT NOT NULL DEFAULT ''
+	);`
+
+	// Create API tokens table, only the SHA-256 hash of a token is stored. Sites lists the comma separated sites a
+	// technician services.
+	createTokensTable := `
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		hash TEXT NOT NULL UNIQUE,
+		created_at DATETIME NOT NULL,
+		last_used_at DATETIME,
+		revoked_at DATETIME,
+		role TEXT NOT NULL DEFAULT 'admin',
+		sites TEXT NOT NULL DEFAULT ''
+	);`
+
 	if _, err = p.Db.Exec(createDevicesTable); err != nil {
 		return fmt.Errorf("failed to create devices table: %v", err)
 	}
 
+	// Columns added to the devices table after its first release
+	if err = p.ensureColumn("devices", "threshold", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err = p.ensureColumn("devices", "model", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err = p.ensureColumn("devices", "last_maintenance", "DATETIME"); err != nil {
+		return err
+	}
+	if err = p.ensureColumn("devices", "decommissioned_at", "DATETIME"); err != nil {
+		return err
+	}
+	if err = p.ensureColumn("devices", "serial", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err = p.ensureColumn("devices", "site", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
 	if _, err = p.Db.Exec(createLogsTable); err != nil {
 		return fmt.Errorf("failed to create logs table: %v", err)
 	}
+	if _, err = p.Db.Exec("CREATE INDEX IF NOT EXISTS logs_time ON logs (" + logSortableTime + ")"); err != nil {
+		return fmt.Errorf("failed to create logs time index: %v", err)
+	}
+
+	if _, err = p.Db.Exec(createMaintenanceTable); err != nil {
+		return fmt.Errorf("failed to create maintenance_records table: %v", err)
+	}
+
+	if _, err = p.Db.Exec(createWorkOrdersTable); err != nil {
+		return fmt.Errorf("failed to create work_orders table: %v", err)
+	}
+	if err = p.ensureColumn("work_orders", "reason", "TEXT NOT NULL DEFAULT 'threshold'"); err != nil {
+		return err
+	}
+
+	if _, err = p.Db.Exec(createModelsTable); err != nil {
+		return fmt.Errorf("failed to create device_models table: %v", err)
+	}
+	if err = p.ensureColumn("device_models", "interval_days", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	if _, err = p.Db.Exec(createExemptionsTable); err != nil {
+		return fmt.Errorf("failed to create lockout_exemptions table: %v", err)
+	}
+
+	if _, err = p.Db.Exec(createDeferralsTable); err != nil {
+		return fmt.Errorf("failed to create maintenance_deferrals table: %v", err)
+	}
+
+	if _, err = p.Db.Exec(createAuditTable); err != nil {
+		return fmt.Errorf("failed to create audit_log table: %v", err)
+	}
+
+	if _, err = p.Db.Exec(createSettingsTable); err != nil {
+		return fmt.Errorf("failed to create settings table: %v", err)
+	}
+
+	if _, err = p.Db.Exec(createTokensTable); err != nil {
+		return fmt.Errorf("failed to create api_tokens table: %v", err)
+	}
+
+	// Tokens issued before roles existed keep full access
+	if err = p.ensureColumn("api_tokens", "role", "TEXT NOT NULL DEFAULT 'admin'"); err != nil {
+		return err
+	}
+	if err = p.ensureColumn("api_tokens", "sites", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
 
 	log.Println("Database initialized successfully")
 	return nil
 }
 
+// dbDSN returns the data source name of a database encrypted by SQLCipher, or of a plain one without a key. The driver
+// quotes the key in a PRAGMA, so its quotes are doubled and the rest is escaped as it may hold any character.
+func dbDSN(dbName, key string) string {
+	if key == "" {
+		return dbName
+	}
+	return fmt.Sprintf("%s?_pragma_key=%s", dbName, url.QueryEscape(strings.ReplaceAll(key, `"`, `""`)))
+}
+
+// IsPlaintextDB reports whether a database file exists unencrypted, a missing or empty file is created encrypted
+func IsPlaintextDB(dbName string) (bool, error) {
+	info, err := os.Stat(dbName)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && info.Size() == 0) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read database: %v", err)
+	}
+
+	encrypted, err := sqlite3.IsEncrypted(dbName)
+	if err != nil {
+		return false, fmt.Errorf("failed to read database: %v", err)
+	}
+	return !encrypted, nil
+}
+
+// ensureColumn adds a column to a table created by an older version of the schema
+func (p *PlutoServer) ensureColumn(table, column, definition string) error {
+	rows, err := p.Db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s table: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to inspect %s table: %v", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to inspect %s table: %v", table, err)
+	}
+	rows.Close()
+
+	if _, err := p.Db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s to %s table: %v", column, table, err)
+	}
+
+	log.Printf("Added column %s to %s table", column, table)
+	return nil
+}
+
+const deviceColumns = "ip, current_count, total_count, last_seen, registered_at, threshold, model, last_maintenance, " +
+	"decommissioned_at, serial, site"
+
+func scanDevice(row rowScanner) (Device, error) {
+	var device Device
+	var lastSeen, registeredAt string
+	var lastMaintenance, decommissionedAt sql.NullString
+
+	err := row.Scan(&device.IP, &device.CurrentCount, &device.TotalCount, &lastSeen, &registeredAt, &device.Threshold,
+		&device.Model, &lastMaintenance, &decommissionedAt, &device.Serial, &device.Site)
+	if err != nil {
+		return Device{}, err
+	}
+
+	device.LastSeen = parseTime(lastSeen)
+	device.RegisteredAt = parseTime(registeredAt)
+	if lastMaintenance.Valid {
+		device.LastMaintenance = parseTime(lastMaintenance.String)
+	}
+	if decommissionedAt.Valid {
+		device.DecommissionedAt = parseTime(decommissionedAt.String)
+	}
+	return device, nil
+}
+
 func (p *PlutoServer) LoadDevices() error {
-	rows, err := p.Db.Query("SELECT ip, current_count, total_count, last_seen, registered_at FROM devices")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.loadModels(); err != nil {
+		return err
+	}
+
+	rows, err := p.Db.Query("SELECT " + deviceColumns + " FROM devices")
 	if err != nil {
 		return fmt.Errorf("failed to load devices: %v", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var device Device
-		var lastSeen, registeredAt string
-
-		err := rows.Scan(&device.IP, &device.CurrentCount, &device.TotalCount, &lastSeen, &registeredAt)
+		device, err := scanDevice(rows)
 		if err != nil {
 			log.Printf("Error scanning device row: %v", err)
 			continue
 		}
 
-		device.LastSeen = parseTime(lastSeen)
-		device.RegisteredAt = parseTime(registeredAt)
-
 		p.Devices[device.IP] = &device
 	}
 
+	if err := p.loadExemptions(); err != nil {
+		return err
+	}
+	if err := p.loadDeferrals(); err != nil {
+		return err
+	}
+
 	log.Printf("Loaded %d devices from database", len(p.Devices))
 	return nil
 }
@@ -86,18 +398,41 @@ func parseTime(timeStr string) time.Time {
 		return t.UTC()
 	}
 
+	// Values written by formatTime hold server local wall-clock time, which the driver hands back as RFC3339 UTC
+	t, err = time.Parse(time.RFC3339, timeStr)
+	if err == nil {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local).UTC()
+	}
+
 	log.Printf("Error parsing time string: %s", timeStr)
 	return time.Now()
 }
 
+// formatTime renders a timestamp for DATETIME columns in server local time
+func formatTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// nullableTime stores zero timestamps as NULL
+func nullableTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return formatTime(t)
+}
+
 func (p *PlutoServer) SaveDevice(device *Device) error {
+	return saveDevice(p.Db, device)
+}
+
+func saveDevice(db execer, device *Device) error {
 	query := `
-	INSERT OR REPLACE INTO devices (ip, current_count, total_count, last_seen, registered_at)
-	VALUES (?, ?, ?, ?, ?)`
+	INSERT OR REPLACE INTO devices (` + deviceColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := p.Db.Exec(query, device.IP, device.CurrentCount, device.TotalCount,
-		device.LastSeen.Format("2006-01-02 15:04:05"),
-		device.RegisteredAt.Format("2006-01-02 15:04:05"))
+	_, err := db.Exec(query, device.IP, device.CurrentCount, device.TotalCount,
+		formatTime(device.LastSeen), formatTime(device.RegisteredAt), device.Threshold, device.Model,
+		nullableTime(device.LastMaintenance), nullableTime(device.DecommissionedAt), device.Serial, device.Site)
 
 	if err != nil {
 		return fmt.Errorf("failed to save device %s: %v", device.IP, err)
@@ -107,6 +442,40 @@ func (p *PlutoServer) SaveDevice(device *Device) error {
 }
 
 func (p *PlutoServer) SaveLog(deviceIP, action string, countValue, response int) error {
+	return saveLog(p.Db, deviceIP, action, countValue, response)
+}
+
+// logSortableTime rewrites the logs timestamp layout, 15:04:05 02/01/2006 in UTC+3, as 2006-01-02 15:04:05 so it can
+// be compared and indexed. Queries must use the exact expression for SQLite to pick the logs_time index.
+const logSortableTime = "substr(timestamp, 16, 4) || '-' || substr(timestamp, 13, 2) || '-' || substr(timestamp, 10, 2) || ' ' || substr(timestamp, 1, 8)"
+
+// logTimeArg renders a bound compared with logSortableTime. Logs are stored to the second, so a bound within a second
+// is moved up to the next one, which keeps >= and < matching the same rows as comparing the parsed timestamps.
+func logTimeArg(t time.Time) string {
+	if rounded := t.Truncate(time.Second); !rounded.Equal(t) {
+		t = rounded.Add(time.Second)
+	}
+	utc3Location := time.FixedZone("UTC+3", 3*3600)
+	return t.In(utc3Location).Format("2006-01-02 15:04:05")
+}
+
+// logTimeFilter returns the conditions and arguments selecting logs within an inclusive from and an exclusive to
+// bound, a zero bound is left open
+func logTimeFilter(from, to time.Time) (string, []any) {
+	var query string
+	var args []any
+	if !from.IsZero() {
+		query += " AND " + logSortableTime + " >= ?"
+		args = append(args, logTimeArg(from))
+	}
+	if !to.IsZero() {
+		query += " AND " + logSortableTime + " < ?"
+		args = append(args, logTimeArg(to))
+	}
+	return query, args
+}
+
+func saveLog(db execer, deviceIP, action string, countValue, response int) error {
 	query := `
 	INSERT INTO logs (device_ip, action, count_value, timestamp, response)
 	VALUES (?, ?, ?, ?, ?)`
@@ -114,7 +483,7 @@ func (p *PlutoServer) SaveLog(deviceIP, action string, countValue, response int)
 	utc3Location := time.FixedZone("UTC+3", 3*3600)
 	timestamp := time.Now().In(utc3Location).Format("15:04:05 02/01/2006")
 
-	_, err := p.Db.Exec(query, deviceIP, action, countValue, timestamp, response)
+	_, err := db.Exec(query, deviceIP, action, countValue, timestamp, response)
 	if err != nil {
 		return fmt.Errorf("failed to save log for device %s: %v", deviceIP, err)
 	}
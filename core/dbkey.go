@@ -0,0 +1,47 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Environment variables that may hold database keys
+const (
+	DBKeyEnv    = "PLUTO_DB_KEY"     // Key of the database
+	NewDBKeyEnv = "PLUTO_NEW_DB_KEY" // Key the database is re-encrypted with by "pluto rekey"
+)
+
+var (
+	ErrNoDBKey     = errors.New("no database key configured") // PlutoServer.DBKey is empty
+	ErrWrongDBKey  = errors.New("wrong database key")         // The database cannot be decrypted with PlutoServer.DBKey
+	ErrPlaintextDB = errors.New("database is not encrypted")  // Written by a version that did not encrypt it
+)
+
+// ReadDBKeyFile reads the database key from a file. The file must be a regular file that neither its group nor other
+// users can access, a trailing newline is ignored.
+func ReadDBKeyFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read database key file: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("database key file %s is not a regular file", path)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return "", fmt.Errorf("database key file %s is accessible by other users (mode %04o), restrict it with chmod 600",
+			path, perm)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read database key file: %v", err)
+	}
+
+	key := strings.TrimRight(string(data), "\r\n")
+	if key == "" {
+		return "", fmt.Errorf("database key file %s is empty", path)
+	}
+	return key, nil
+}
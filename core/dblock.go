@@ -0,0 +1,37 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrDBInUse is returned when the database is locked by another pluto process, a running server holds it shared and
+// an offline rekey exclusively
+var ErrDBInUse = errors.New("database is in use by another pluto process")
+
+// dbLockSuffix names the lock file next to the database. It is not the database file itself, which a rekey replaces.
+const dbLockSuffix = ".lock"
+
+// HoldDatabase locks the database for a running server until the returned function is called. Servers may share the
+// lock, an offline rekey needs it exclusively and is refused while it is held, so it cannot replace the file under a
+// server that keeps writing to the original.
+func HoldDatabase(dbName string) (func() error, error) {
+	return lockDatabase(dbName, false)
+}
+
+// lockDatabase takes the lock of a database without waiting for it, the returned function releases it
+func lockDatabase(dbName string, exclusive bool) (func() error, error) {
+	file, err := os.OpenFile(dbName+dbLockSuffix, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database lock: %v", err)
+	}
+	if err := lockFile(file, exclusive); err != nil {
+		file.Close()
+		if errors.Is(err, ErrDBInUse) {
+			return nil, fmt.Errorf("%w: %s", err, dbName)
+		}
+		return nil, fmt.Errorf("failed to lock database: %v", err)
+	}
+	return file.Close, nil
+}
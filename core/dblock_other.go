@@ -0,0 +1,10 @@
+//go:build !unix
+
+package core
+
+import "os"
+
+// lockFile is a no-op where flock is not available, stop the server before an offline rekey there
+func lockFile(file *os.File, exclusive bool) error {
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package core
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile takes a shared or exclusive flock, which the kernel releases when the process exits
+func lockFile(file *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	err := syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrDBInUse
+	}
+	return err
+}
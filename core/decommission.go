@@ -0,0 +1,112 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// decommissioned reports whether the device was retired from service
+func (d *Device) decommissioned() bool {
+	return !d.DecommissionedAt.IsZero()
+}
+
+// DecommissionDevice retires a device from service. Its history is kept, but it is left out of the fleet statistics
+// and forecasts and is no longer sent maintenance replies. Actor and reason are required and recorded in the audit log.
+func (p *PlutoServer) DecommissionDevice(deviceIP, actor, reason string) (Device, error) {
+	actor, reason = strings.TrimSpace(actor), strings.TrimSpace(reason)
+	switch {
+	case actor == "":
+		return Device{}, fmt.Errorf("%w: actor is required", ErrInvalidInput)
+	case reason == "":
+		return Device{}, fmt.Errorf("%w: reason is required", ErrInvalidInput)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, exists := p.Devices[deviceIP]
+	if !exists {
+		return Device{}, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceIP)
+	}
+	if device.decommissioned() {
+		return Device{}, fmt.Errorf("%w: device %s is already decommissioned", ErrInvalidTransition, deviceIP)
+	}
+
+	now := time.Now()
+
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return Device{}, fmt.Errorf("failed to begin decommission transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE devices SET decommissioned_at = ? WHERE ip = ?", formatTime(now), deviceIP); err != nil {
+		return Device{}, fmt.Errorf("failed to decommission device %s: %v", deviceIP, err)
+	}
+	details := fmt.Sprintf("%s (current count: %d, total count: %d)", reason, device.CurrentCount, device.TotalCount)
+	if err := audit(tx, AuditDecommission, deviceIP, actor, details); err != nil {
+		return Device{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Device{}, fmt.Errorf("failed to commit decommission of device %s: %v", deviceIP, err)
+	}
+
+	device.DecommissionedAt = now
+	log.Printf("Device %s decommissioned by %s: %s", deviceIP, actor, reason)
+
+	return *device, nil
+}
+
+// PurgeDevice deletes a device together with its logs, maintenance history, work orders, exemptions and deferrals.
+// Only the audit entry recording the purge is kept. A purged device that reports again is registered as new.
+func (p *PlutoServer) PurgeDevice(deviceIP, actor, reason string) error {
+	actor, reason = strings.TrimSpace(actor), strings.TrimSpace(reason)
+	switch {
+	case actor == "":
+		return fmt.Errorf("%w: actor is required", ErrInvalidInput)
+	case reason == "":
+		return fmt.Errorf("%w: reason is required", ErrInvalidInput)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, exists := p.Devices[deviceIP]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceIP)
+	}
+
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin purge transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Rows referencing the device go first, the devices row last
+	for _, table := range []string{"logs", "maintenance_records", "work_orders", "lockout_exemptions", "maintenance_deferrals"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE device_ip = ?", deviceIP); err != nil {
+			return fmt.Errorf("failed to purge %s of device %s: %v", table, deviceIP, err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM devices WHERE ip = ?", deviceIP); err != nil {
+		return fmt.Errorf("failed to purge device %s: %v", deviceIP, err)
+	}
+
+	details := fmt.Sprintf("%s (registered: %s, total count: %d)", reason,
+		device.RegisteredAt.Format(time.DateTime), device.TotalCount)
+	if err := audit(tx, AuditPurge, deviceIP, actor, details); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit purge of device %s: %v", deviceIP, err)
+	}
+
+	delete(p.Devices, deviceIP)
+	log.Printf("Device %s purged by %s: %s", deviceIP, actor, reason)
+
+	return nil
+}
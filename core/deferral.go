@@ -0,0 +1,240 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+var ErrNoActiveDeferral = errors.New("no active maintenance deferral")
+
+// Reasons a deferral ends
+const (
+	DeferralEndExpired     = "expired"     // The date passed or the extra trigger budget was used up
+	DeferralEndCancelled   = "cancelled"   // A supervisor withdrew it
+	DeferralEndReplaced    = "replaced"    // A newer deferral took its place
+	DeferralEndMaintenance = "maintenance" // The device was serviced
+)
+
+const deferralColumns = "id, device_ip, deferred_by, reason, created_at, until, extra_triggers, count_at_deferral, ended_at, end_reason"
+
+// active reports whether the deferral still applies at a point in time for a current trigger count
+func (d *MaintenanceDeferral) active(count int, at time.Time) bool {
+	if d == nil || d.EndedAt != nil {
+		return false
+	}
+	if d.Until != nil && !at.Before(*d.Until) {
+		return false
+	}
+	if d.ExtraTriggers > 0 && count >= d.CountAtDeferral+d.ExtraTriggers {
+		return false
+	}
+	return true
+}
+
+// deferred reports whether the reply of a level is held back by an active deferral, which never holds back a lockout
+func (d *Device) deferred(level MaintenanceLevel, at time.Time) bool {
+	return level > LevelNormal && level < LevelLockout && d.Deferral.active(d.CurrentCount, at)
+}
+
+// loadDeferrals attaches the deferrals that have not ended to the in-memory devices. The caller holds p.mu.
+func (p *PlutoServer) loadDeferrals() error {
+	rows, err := p.Db.Query("SELECT " + deferralColumns + " FROM maintenance_deferrals WHERE ended_at IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to load maintenance deferrals: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		deferral, err := scanDeferral(rows)
+		if err != nil {
+			return err
+		}
+		if device, exists := p.Devices[deferral.DeviceIP]; exists {
+			device.Deferral = &deferral
+		}
+	}
+
+	return rows.Err()
+}
+
+// DeferMaintenance suppresses the approaching, due and overdue replies of a device until a date, until it fires
+// ExtraTriggers more times, or whichever comes first when both are given. It never lifts a lockout.
+// DeferredBy and Reason are required. A new deferral replaces the active one.
+func (p *PlutoServer) DeferMaintenance(deviceIP string, deferral MaintenanceDeferral) (MaintenanceDeferral, error) {
+	deferral.DeferredBy = strings.TrimSpace(deferral.DeferredBy)
+	deferral.Reason = strings.TrimSpace(deferral.Reason)
+	now := time.Now()
+
+	switch {
+	case deferral.DeferredBy == "":
+		return MaintenanceDeferral{}, fmt.Errorf("%w: deferred_by is required", ErrInvalidInput)
+	case deferral.Reason == "":
+		return MaintenanceDeferral{}, fmt.Errorf("%w: reason is required", ErrInvalidInput)
+	case deferral.Until == nil && deferral.ExtraTriggers == 0:
+		return MaintenanceDeferral{}, fmt.Errorf("%w: until or extra_triggers is required", ErrInvalidInput)
+	case deferral.Until != nil && !deferral.Until.After(now):
+		return MaintenanceDeferral{}, fmt.Errorf("%w: until must be in the future", ErrInvalidInput)
+	case deferral.ExtraTriggers < 0:
+		return MaintenanceDeferral{}, fmt.Errorf("%w: extra_triggers must not be negative", ErrInvalidInput)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, exists := p.Devices[deviceIP]
+	if !exists {
+		return MaintenanceDeferral{}, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceIP)
+	}
+
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return MaintenanceDeferral{}, fmt.Errorf("failed to begin deferral transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := endDeferrals(tx, deviceIP, DeferralEndReplaced, now); err != nil {
+		return MaintenanceDeferral{}, err
+	}
+
+	deferral.DeviceIP = deviceIP
+	deferral.CreatedAt = now
+	deferral.CountAtDeferral = device.CurrentCount
+	deferral.EndedAt = nil
+	deferral.EndReason = ""
+
+	var until any
+	if deferral.Until != nil {
+		until = formatTime(*deferral.Until)
+	}
+
+	query := `
+	INSERT INTO maintenance_deferrals (device_ip, deferred_by, reason, created_at, until, extra_triggers, count_at_deferral)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := tx.Exec(query, deviceIP, deferral.DeferredBy, deferral.Reason, formatTime(now), until,
+		deferral.ExtraTriggers, deferral.CountAtDeferral)
+	if err != nil {
+		return MaintenanceDeferral{}, fmt.Errorf("failed to save maintenance deferral for device %s: %v", deviceIP, err)
+	}
+	if deferral.ID, err = result.LastInsertId(); err != nil {
+		return MaintenanceDeferral{}, fmt.Errorf("failed to read maintenance deferral id for device %s: %v", deviceIP, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return MaintenanceDeferral{}, fmt.Errorf("failed to commit maintenance deferral for device %s: %v", deviceIP, err)
+	}
+
+	device.Deferral = &deferral
+	log.Printf("Maintenance of %s deferred by %s (until: %v, extra triggers: %d): %s",
+		deviceIP, deferral.DeferredBy, deferral.Until, deferral.ExtraTriggers, deferral.Reason)
+
+	return deferral, nil
+}
+
+// CancelDeferral ends the active deferral of a device early
+func (p *PlutoServer) CancelDeferral(deviceIP string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, exists := p.Devices[deviceIP]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceIP)
+	}
+	if !device.Deferral.active(device.CurrentCount, time.Now()) {
+		return fmt.Errorf("%w: %s", ErrNoActiveDeferral, deviceIP)
+	}
+
+	if err := endDeferrals(p.Db, deviceIP, DeferralEndCancelled, time.Now()); err != nil {
+		return err
+	}
+
+	device.Deferral = nil
+	log.Printf("Maintenance deferral of %s cancelled", deviceIP)
+	return nil
+}
+
+// expireDeferral records the end of a deferral whose date or trigger budget ran out. The caller holds p.mu.
+func (p *PlutoServer) expireDeferral(device *Device, at time.Time) {
+	if device.Deferral == nil || device.Deferral.active(device.CurrentCount, at) {
+		return
+	}
+
+	if err := endDeferrals(p.Db, device.IP, DeferralEndExpired, at); err != nil {
+		log.Printf("Error expiring maintenance deferral: %v", err)
+		return
+	}
+
+	device.Deferral = nil
+	log.Printf("Maintenance deferral of %s expired (count: %d)", device.IP, device.CurrentCount)
+}
+
+// ExpireDeferrals records the end of every deferral that ran out, including those of devices that are powered off
+func (p *PlutoServer) ExpireDeferrals() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for _, device := range p.Devices {
+		p.expireDeferral(device, now)
+	}
+}
+
+func endDeferrals(db execer, deviceIP, endReason string, at time.Time) error {
+	_, err := db.Exec("UPDATE maintenance_deferrals SET ended_at = ?, end_reason = ? WHERE device_ip = ? AND ended_at IS NULL",
+		formatTime(at), endReason, deviceIP)
+	if err != nil {
+		return fmt.Errorf("failed to end maintenance deferrals for device %s: %v", deviceIP, err)
+	}
+	return nil
+}
+
+// Deferrals returns every deferral of a device, oldest first
+func (p *PlutoServer) Deferrals(deviceIP string) ([]MaintenanceDeferral, error) {
+	if _, exists := p.DeviceSnapshot(deviceIP); !exists {
+		return nil, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceIP)
+	}
+
+	rows, err := p.Db.Query("SELECT "+deferralColumns+" FROM maintenance_deferrals WHERE device_ip = ? ORDER BY id", deviceIP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query maintenance deferrals for device %s: %v", deviceIP, err)
+	}
+	defer rows.Close()
+
+	deferrals := []MaintenanceDeferral{}
+	for rows.Next() {
+		deferral, err := scanDeferral(rows)
+		if err != nil {
+			return nil, err
+		}
+		deferrals = append(deferrals, deferral)
+	}
+
+	return deferrals, rows.Err()
+}
+
+func scanDeferral(row rowScanner) (MaintenanceDeferral, error) {
+	var deferral MaintenanceDeferral
+	var createdAt string
+	var until, endedAt sql.NullString
+
+	err := row.Scan(&deferral.ID, &deferral.DeviceIP, &deferral.DeferredBy, &deferral.Reason, &createdAt, &until,
+		&deferral.ExtraTriggers, &deferral.CountAtDeferral, &endedAt, &deferral.EndReason)
+	if err != nil {
+		return MaintenanceDeferral{}, fmt.Errorf("failed to scan maintenance deferral: %v", err)
+	}
+
+	deferral.CreatedAt = parseTime(createdAt)
+	if until.Valid {
+		t := parseTime(until.String)
+		deferral.Until = &t
+	}
+	if endedAt.Valid {
+		t := parseTime(endedAt.String)
+		deferral.EndedAt = &t
+	}
+	return deferral, nil
+}
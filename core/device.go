@@ -12,9 +12,15 @@ type StartupResponse int
 const (
 	StartupResponseNormal           StartupResponse = iota // 0
 	StartupResponseThresholdReached                        // 1
+	StartupResponseApproaching                             // 2
+	StartupResponseOverdue                                 // 3
+	StartupResponseLockout                                 // 4, the device must refuse operation until serviced
 )
 
 func (p *PlutoServer) HandleStartup(deviceIP string) StartupResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	now := time.Now()
 
 	device, exists := p.Devices[deviceIP]
@@ -31,6 +37,10 @@ func (p *PlutoServer) HandleStartup(deviceIP string) StartupResponse {
 	} else {
 		device.LastSeen = now
 		log.Printf("Device startup: %s (current count: %d)", deviceIP, device.CurrentCount)
+		if device.decommissioned() {
+			log.Printf("Decommissioned device %s is still reporting", deviceIP)
+		}
+		p.expireDeferral(device, now)
 	}
 
 	if err := p.SaveDevice(device); err != nil {
@@ -38,18 +48,25 @@ func (p *PlutoServer) HandleStartup(deviceIP string) StartupResponse {
 	}
 
 	response := StartupResponseNormal
-	if device.CurrentCount >= p.Threshold {
-		response = StartupResponseThresholdReached
+	if level := p.levelAt(device, device.CurrentCount); !device.deferred(level, now) {
+		response = level.Response()
 	}
 
 	if err := p.SaveLog(deviceIP, "startup", device.CurrentCount, int(response)); err != nil {
 		log.Printf("Error saving log: %v", err)
 	}
 
+	event := p.deviceEvent(EventStartup, device, now)
+	event.Response = &response
+	p.publish(event)
+
 	return response
 }
 
 func (p *PlutoServer) HandleCountIncrement(deviceIP string, increment int) StartupResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	now := time.Now()
 
 	device, exists := p.Devices[deviceIP]
@@ -69,18 +86,40 @@ func (p *PlutoServer) HandleCountIncrement(deviceIP string, increment int) Start
 	device.CurrentCount += increment
 	device.TotalCount += increment
 	device.LastSeen = now
+	if device.decommissioned() {
+		log.Printf("Decommissioned device %s is still reporting", deviceIP)
+	}
 
 	if err := p.SaveDevice(device); err != nil {
 		log.Printf("Error saving device: %v", err)
 	}
 
 	response := StartupResponseNormal
-	wasAbove := oldCount >= p.Threshold
-	isAbove := device.CurrentCount >= p.Threshold
+	oldLevel := p.levelAt(device, oldCount)
+	newLevel := p.levelAt(device, device.CurrentCount)
 
-	if !wasAbove && isAbove {
-		response = StartupResponseThresholdReached
+	// Only a move to a higher level is reported, the device is not told the same level twice. A deferral that ran out
+	// since the last update releases the level it held back.
+	deferralEnded := device.Deferral != nil && !device.Deferral.active(device.CurrentCount, now)
+	if newLevel > oldLevel {
+		log.Printf("Device %s maintenance level %s -> %s: %d -> %d", deviceIP, oldLevel, newLevel, oldCount, device.CurrentCount)
+	}
+	if (newLevel > oldLevel || deferralEnded) && !device.deferred(newLevel, now) {
+		response = newLevel.Response()
+	}
+
+	if oldLevel < LevelDue && newLevel >= LevelDue {
 		log.Printf("Device %s crossed threshold: %d -> %d", deviceIP, oldCount, device.CurrentCount)
+		if _, err := p.openWorkOrder(device, WorkOrderReasonThreshold); err != nil {
+			log.Printf("Error opening work order: %v", err)
+		}
+	}
+
+	p.expireDeferral(device, now)
+
+	if limit := p.policyFor(device).LifetimeLimit; limit > 0 && device.TotalCount >= limit && device.TotalCount-increment < limit {
+		log.Printf("Device %s reached the lifetime limit of its model %s: total count %d (limit: %d)",
+			deviceIP, device.Model, device.TotalCount, limit)
 	}
 
 	action := fmt.Sprintf("increment+%d", increment)
@@ -88,46 +127,190 @@ func (p *PlutoServer) HandleCountIncrement(deviceIP string, increment int) Start
 		log.Printf("Error saving log: %v", err)
 	}
 
+	event := p.deviceEvent(EventIncrement, device, now)
+	event.Increment = increment
+	event.Response = &response
+	p.publish(event)
+	if newLevel > oldLevel {
+		crossing := p.deviceEvent(EventThresholdCrossing, device, now)
+		crossing.PreviousStatus = &oldLevel
+		p.publish(crossing)
+	}
+
 	log.Printf("Count update %s: %d -> %d (Total: %d)", deviceIP, oldCount, device.CurrentCount, device.TotalCount)
 	return response
 }
 
-func (p *PlutoServer) PrintStats() {
-	totalDevices := len(p.Devices)
-	activeDevices := 0
-	belowThreshold := 0
-	aboveThreshold := 0
-	totalCurrentCount := 0
-	totalAggregateCount := 0
+// DeviceSnapshot returns a copy of a device's in-memory state
+func (p *PlutoServer) DeviceSnapshot(deviceIP string) (Device, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	now := time.Now()
-	for _, device := range p.Devices {
-		totalCurrentCount += device.CurrentCount
-		totalAggregateCount += device.TotalCount
+	device, exists := p.Devices[deviceIP]
+	if !exists {
+		return Device{}, false
+	}
+	return *device, true
+}
+
+// SetDeviceThreshold sets the maintenance threshold of a single device, 0 restores the global threshold.
+// A device that is due under its new threshold gets a work order like a regular threshold crossing.
+func (p *PlutoServer) SetDeviceThreshold(deviceIP string, threshold int) (Device, error) {
+	if threshold < 0 {
+		return Device{}, fmt.Errorf("%w: threshold must not be negative", ErrInvalidInput)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, exists := p.Devices[deviceIP]
+	if !exists {
+		return Device{}, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceIP)
+	}
+
+	if _, err := p.Db.Exec("UPDATE devices SET threshold = ? WHERE ip = ?", threshold, deviceIP); err != nil {
+		return Device{}, fmt.Errorf("failed to save threshold for device %s: %v", deviceIP, err)
+	}
+
+	oldLevel := p.levelAt(device, device.CurrentCount)
+	device.Threshold = threshold
 
-		if now.Sub(device.LastSeen) < 10*time.Minute {
-			activeDevices++
+	log.Printf("Device %s threshold set to %d (effective: %d)", deviceIP, threshold, p.thresholdFor(device))
+	p.checkCrossing(device, oldLevel)
+
+	return *device, nil
+}
+
+// activityWindows are the exclusive last-seen buckets of FleetStats.ByActivity, the first one defines an active device
+var activityWindows = []struct {
+	name   string
+	within time.Duration
+}{
+	{"last_10m", 10 * time.Minute},
+	{"last_1h", time.Hour},
+	{"last_24h", 24 * time.Hour},
+	{"last_7d", 7 * 24 * time.Hour},
+}
+
+// FleetStats summarizes the state of every device
+type FleetStats struct {
+	GeneratedAt       time.Time      `json:"generated_at"`
+	TotalDevices      int            `json:"total_devices"`  // Devices in service, decommissioned ones are only counted below
+	Decommissioned    int            `json:"decommissioned"` // Retired devices, excluded from every other figure
+	ActiveDevices     int            `json:"active_devices"` // Seen within the last 10 minutes
+	BelowThreshold    int            `json:"below_threshold"`
+	AboveThreshold    int            `json:"above_threshold"`
+	PastLifetimeLimit int            `json:"past_lifetime_limit"`
+	TotalCurrentCount int            `json:"total_current_count"`
+	GrandTotalCount   int            `json:"grand_total_count"`
+	ByStatus          map[string]int `json:"by_status"`   // Device count per maintenance level
+	ByActivity        map[string]int `json:"by_activity"` // Device count per last-seen window, older devices under "older"
+}
+
+// Stats computes the fleet statistics on demand
+func (p *PlutoServer) Stats() FleetStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.stats(time.Now())
+}
+
+// stats implements Stats, the caller holds p.mu
+func (p *PlutoServer) stats(now time.Time) FleetStats {
+	stats := FleetStats{
+		GeneratedAt: now,
+		ByStatus:    make(map[string]int),
+		ByActivity:  map[string]int{"older": 0},
+	}
+	for level := LevelNormal; level <= LevelLockout; level++ {
+		stats.ByStatus[level.String()] = 0
+	}
+	for _, window := range activityWindows {
+		stats.ByActivity[window.name] = 0
+	}
+
+	for _, device := range p.Devices {
+		if device.decommissioned() {
+			stats.Decommissioned++
+			continue
 		}
 
-		if device.CurrentCount < p.Threshold {
-			belowThreshold++
+		stats.TotalDevices++
+		stats.TotalCurrentCount += device.CurrentCount
+		stats.GrandTotalCount += device.TotalCount
+
+		if device.CurrentCount < p.thresholdFor(device) {
+			stats.BelowThreshold++
 		} else {
-			aboveThreshold++
+			stats.AboveThreshold++
+		}
+
+		stats.ByStatus[p.levelAt(device, device.CurrentCount).String()]++
+		if p.lifetimeExceeded(device) {
+			stats.PastLifetimeLimit++
 		}
+
+		bucket := "older"
+		for _, window := range activityWindows {
+			if now.Sub(device.LastSeen) < window.within {
+				bucket = window.name
+				break
+			}
+		}
+		stats.ByActivity[bucket]++
 	}
+	stats.ActiveDevices = stats.ByActivity[activityWindows[0].name]
+
+	return stats
+}
+
+func (p *PlutoServer) PrintStats() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	stats := p.stats(now)
 
 	log.Printf("Stats - Total devices: %d, Active: %d, Below threshold: %d, Above: %d, Total current count: %d, Grand total count: %d",
-		totalDevices, activeDevices, belowThreshold, aboveThreshold, totalCurrentCount, totalAggregateCount)
+		stats.TotalDevices, stats.ActiveDevices, stats.BelowThreshold, stats.AboveThreshold, stats.TotalCurrentCount, stats.GrandTotalCount)
+	log.Printf("Stats - Maintenance levels: normal: %d, approaching: %d, due: %d, overdue: %d, lockout: %d, past lifetime limit: %d",
+		stats.ByStatus["normal"], stats.ByStatus["approaching"], stats.ByStatus["due"], stats.ByStatus["overdue"],
+		stats.ByStatus["lockout"], stats.PastLifetimeLimit)
+
+	forecasts, err := p.forecasts(DefaultForecastWindowDays)
+	if err != nil {
+		log.Printf("Error computing forecasts: %v", err)
+		return
+	}
+
+	// Only the devices that will need a crew within the forecast window are listed
+	var upcoming []string
+	horizon := now.AddDate(0, 0, DefaultForecastWindowDays)
+	for _, forecast := range forecasts {
+		if forecast.ProjectedDate == nil || forecast.ProjectedDate.After(horizon) {
+			break
+		}
+		upcoming = append(upcoming, fmt.Sprintf("%s on %s (%.1f/day)",
+			forecast.IP, forecast.ProjectedDate.Format(time.DateOnly), forecast.DailyRate))
+	}
+
+	log.Printf("Stats - Forecast due within %d days: %d %v", DefaultForecastWindowDays, len(upcoming), upcoming)
 }
 
 func (p *PlutoServer) StartPeriodicTasks() {
 	statsTicker := time.NewTicker(5 * time.Minute)
+	calendarTicker := time.NewTicker(time.Hour)
 
 	go func() {
+		p.CheckCalendarDue()
+
 		for {
 			select {
 			case <-statsTicker.C:
 				p.PrintStats()
+			case <-calendarTicker.C:
+				p.CheckCalendarDue()
+				p.ExpireDeferrals()
 			}
 		}
 	}()
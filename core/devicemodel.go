@@ -0,0 +1,151 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrModelNotFound = errors.New("device model not found")
+	ErrModelInUse    = errors.New("device model in use")
+)
+
+// loadModels replaces the in-memory models with the device_models table. The caller holds p.mu.
+func (p *PlutoServer) loadModels() error {
+	rows, err := p.Db.Query("SELECT name, threshold, warning_percent, lifetime_limit, interval_days FROM device_models")
+	if err != nil {
+		return fmt.Errorf("failed to load device models: %v", err)
+	}
+	defer rows.Close()
+
+	models := make(map[string]*DeviceModel)
+	for rows.Next() {
+		var model DeviceModel
+		if err := rows.Scan(&model.Name, &model.Threshold, &model.WarningPercent, &model.LifetimeLimit, &model.IntervalDays); err != nil {
+			return fmt.Errorf("failed to scan device model: %v", err)
+		}
+		models[model.Name] = &model
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load device models: %v", err)
+	}
+
+	p.Models = models
+	log.Printf("Loaded %d device models from database", len(p.Models))
+	return nil
+}
+
+// DeviceModels returns every device model sorted by name
+func (p *PlutoServer) DeviceModels() []DeviceModel {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	models := make([]DeviceModel, 0, len(p.Models))
+	for _, model := range p.Models {
+		models = append(models, *model)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].Name < models[j].Name })
+	return models
+}
+
+// SaveModel creates or updates a device model. Units of the model that become due under the new policy get a
+// work order like a regular threshold crossing.
+func (p *PlutoServer) SaveModel(model DeviceModel) (DeviceModel, error) {
+	model.Name = strings.TrimSpace(model.Name)
+	switch {
+	case model.Name == "":
+		return DeviceModel{}, fmt.Errorf("%w: model name is required", ErrInvalidInput)
+	case model.Threshold <= 0:
+		return DeviceModel{}, fmt.Errorf("%w: model threshold must be positive", ErrInvalidInput)
+	case model.WarningPercent < 0 || model.WarningPercent > 100:
+		return DeviceModel{}, fmt.Errorf("%w: warning percentage must be between 0 and 100", ErrInvalidInput)
+	case model.LifetimeLimit < 0:
+		return DeviceModel{}, fmt.Errorf("%w: lifetime limit must not be negative", ErrInvalidInput)
+	case model.IntervalDays < 0:
+		return DeviceModel{}, fmt.Errorf("%w: maintenance interval must not be negative", ErrInvalidInput)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	query := `
+	INSERT OR REPLACE INTO device_models (name, threshold, warning_percent, lifetime_limit, interval_days)
+	VALUES (?, ?, ?, ?, ?)`
+
+	_, err := p.Db.Exec(query, model.Name, model.Threshold, model.WarningPercent, model.LifetimeLimit, model.IntervalDays)
+	if err != nil {
+		return DeviceModel{}, fmt.Errorf("failed to save device model %s: %v", model.Name, err)
+	}
+
+	oldLevels := make(map[*Device]MaintenanceLevel)
+	for _, device := range p.Devices {
+		if device.Model == model.Name {
+			oldLevels[device] = p.levelAt(device, device.CurrentCount)
+		}
+	}
+
+	if p.Models == nil {
+		p.Models = make(map[string]*DeviceModel)
+	}
+	p.Models[model.Name] = &model
+	log.Printf("Device model %s saved: threshold %d, warning %d%%, lifetime limit %d, interval %d days",
+		model.Name, model.Threshold, model.WarningPercent, model.LifetimeLimit, model.IntervalDays)
+
+	for device, oldLevel := range oldLevels {
+		p.checkCrossing(device, oldLevel)
+	}
+
+	return model, nil
+}
+
+// DeleteModel removes a device model that no device is assigned to
+func (p *PlutoServer) DeleteModel(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.Models[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrModelNotFound, name)
+	}
+	for _, device := range p.Devices {
+		if device.Model == name {
+			return fmt.Errorf("%w: %s is assigned to device %s", ErrModelInUse, name, device.IP)
+		}
+	}
+
+	if _, err := p.Db.Exec("DELETE FROM device_models WHERE name = ?", name); err != nil {
+		return fmt.Errorf("failed to delete device model %s: %v", name, err)
+	}
+
+	delete(p.Models, name)
+	log.Printf("Device model %s deleted", name)
+	return nil
+}
+
+// AssignModel assigns a device to a model, an empty name removes the assignment
+func (p *PlutoServer) AssignModel(deviceIP, name string) (Device, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, exists := p.Devices[deviceIP]
+	if !exists {
+		return Device{}, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceIP)
+	}
+	if _, exists := p.Models[name]; name != "" && !exists {
+		return Device{}, fmt.Errorf("%w: %s", ErrModelNotFound, name)
+	}
+
+	if _, err := p.Db.Exec("UPDATE devices SET model = ? WHERE ip = ?", name, deviceIP); err != nil {
+		return Device{}, fmt.Errorf("failed to save model for device %s: %v", deviceIP, err)
+	}
+
+	oldLevel := p.levelAt(device, device.CurrentCount)
+	device.Model = name
+
+	log.Printf("Device %s assigned to model %q (effective threshold: %d)", deviceIP, name, p.thresholdFor(device))
+	p.checkCrossing(device, oldLevel)
+
+	return *device, nil
+}
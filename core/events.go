@@ -0,0 +1,144 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EventType identifies what a streamed Event reports
+type EventType string
+
+const (
+	EventStartup           EventType = "startup"            // A device announced its startup
+	EventIncrement         EventType = "increment"          // A device reported new triggers
+	EventThresholdCrossing EventType = "threshold_crossing" // A device moved to a higher maintenance level
+	EventReload            EventType = "reload"             // The devices were reloaded from the database
+)
+
+// eventBuffer is the number of events a subscriber may fall behind before further events are dropped for it
+const eventBuffer = 64
+
+// eventKeepAlive is the interval of the comment lines that keep idle streams open through proxies
+const eventKeepAlive = 30 * time.Second
+
+// Event is a change pushed to live subscribers as it is processed
+type Event struct {
+	Type           EventType         `json:"type"`
+	Time           time.Time         `json:"time"`
+	DeviceIP       string            `json:"device_ip,omitempty"`
+	CurrentCount   int               `json:"current_count"` // Always sent, 0 is a real count right after a maintenance reset
+	TotalCount     int               `json:"total_count,omitempty"`
+	Increment      int               `json:"increment,omitempty"`
+	Status         *MaintenanceLevel `json:"status,omitempty"`
+	PreviousStatus *MaintenanceLevel `json:"previous_status,omitempty"`
+	Response       *StartupResponse  `json:"response,omitempty"`
+	Devices        int               `json:"devices,omitempty"` // Number of devices loaded by a reload
+}
+
+// eventHub fans events out to subscribers, its zero value is ready to use
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]string // Subscriber channel to device filter, empty for every device
+}
+
+// SubscribeEvents returns a channel receiving the events of deviceIP, or of every device when it is empty, and a
+// function that ends the subscription. Events are dropped for a subscriber that does not keep up.
+func (p *PlutoServer) SubscribeEvents(deviceIP string) (<-chan Event, func()) {
+	ch := make(chan Event, eventBuffer)
+
+	p.events.mu.Lock()
+	if p.events.subscribers == nil {
+		p.events.subscribers = make(map[chan Event]string)
+	}
+	p.events.subscribers[ch] = deviceIP
+	p.events.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			p.events.mu.Lock()
+			delete(p.events.subscribers, ch)
+			p.events.mu.Unlock()
+		})
+	}
+}
+
+// publish sends an event to the matching subscribers without blocking the caller
+func (p *PlutoServer) publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	p.events.mu.Lock()
+	defer p.events.mu.Unlock()
+
+	for ch, deviceIP := range p.events.subscribers {
+		if deviceIP != "" && event.DeviceIP != "" && deviceIP != event.DeviceIP {
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// deviceEvent builds an event carrying the current state of a device, the caller holds p.mu
+func (p *PlutoServer) deviceEvent(eventType EventType, device *Device, at time.Time) Event {
+	level := p.levelAt(device, device.CurrentCount)
+	return Event{
+		Type:         eventType,
+		Time:         at,
+		DeviceIP:     device.IP,
+		CurrentCount: device.CurrentCount,
+		TotalCount:   device.TotalCount,
+		Status:       &level,
+	}
+}
+
+// handleAPIEvents streams events as Server-Sent Events until the client disconnects
+func (p *PlutoServer) handleAPIEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := p.SubscribeEvents(r.URL.Query().Get("device"))
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Error encoding event: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
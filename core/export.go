@@ -0,0 +1,245 @@
+package core
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Datasets that can be exported
+const (
+	ExportDevices     = "devices"
+	ExportLogs        = "logs"
+	ExportMaintenance = "maintenance"
+)
+
+// Export formats
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson" // One JSON object per line
+)
+
+// ExportQuery selects the data written by Export
+type ExportQuery struct {
+	Dataset string
+	Format  string    // ExportCSV when empty
+	From    time.Time // Inclusive, only applies to logs and maintenance
+	To      time.Time // Exclusive, only applies to logs and maintenance
+}
+
+// validate checks the query and applies defaults
+func (q *ExportQuery) validate() error {
+	if q.Format == "" {
+		q.Format = ExportCSV
+	}
+
+	switch {
+	case q.Dataset != ExportDevices && q.Dataset != ExportLogs && q.Dataset != ExportMaintenance:
+		return fmt.Errorf("%w: unknown dataset %q (use devices, logs or maintenance)", ErrInvalidInput, q.Dataset)
+	case q.Format != ExportCSV && q.Format != ExportNDJSON:
+		return fmt.Errorf("%w: unknown format %q (use csv or ndjson)", ErrInvalidInput, q.Format)
+	case !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To):
+		return fmt.Errorf("%w: from must be before to", ErrInvalidInput)
+	}
+	return nil
+}
+
+// inRange reports whether a timestamp lies within the From and To bounds of the query
+func (q *ExportQuery) inRange(t time.Time) bool {
+	return (q.From.IsZero() || !t.Before(q.From)) && (q.To.IsZero() || t.Before(q.To))
+}
+
+// exportWriter writes rows in the format of an export, CSV rows use the fields and NDJSON lines the value
+type exportWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func newExportWriter(w io.Writer, format string, columns []string) (*exportWriter, error) {
+	if format == ExportNDJSON {
+		return &exportWriter{json: json.NewEncoder(w)}, nil
+	}
+
+	writer := &exportWriter{csv: csv.NewWriter(w)}
+	return writer, writer.csv.Write(columns)
+}
+
+func (e *exportWriter) write(fields []string, v any) error {
+	if e.json != nil {
+		return e.json.Encode(v)
+	}
+	return e.csv.Write(fields)
+}
+
+func (e *exportWriter) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+	return nil
+}
+
+// exportBatchSize is the number of log or maintenance rows read at once. No cursor stays open while rows are written
+// to a possibly slow client, it would hold the read lock of the database and block every update until the download
+// ends.
+const exportBatchSize = 500
+
+// Export streams a dataset to w in batches, oldest first, so large histories are never held in memory as a whole.
+// Devices are read from the database, which every update is written to.
+func (p *PlutoServer) Export(w io.Writer, q ExportQuery) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+
+	var columns []string
+	switch q.Dataset {
+	case ExportDevices:
+		columns = []string{"ip", "serial", "model", "current_count", "total_count", "threshold", "registered_at",
+			"last_seen", "last_maintenance", "decommissioned_at", "site"}
+	case ExportLogs:
+		columns = []string{"id", "device_ip", "action", "count_value", "timestamp", "response"}
+	case ExportMaintenance:
+		columns = []string{"id", "device_ip", "performed_at", "count_at_reset", "technician", "kind", "notes"}
+	}
+
+	writer, err := newExportWriter(w, q.Format, columns)
+	if err != nil {
+		return fmt.Errorf("failed to write %s export: %v", q.Dataset, err)
+	}
+
+	switch q.Dataset {
+	case ExportDevices:
+		err = p.exportDevices(writer)
+	case ExportLogs:
+		err = p.exportLogs(writer, q)
+	case ExportMaintenance:
+		err = p.exportMaintenance(writer, q)
+	}
+	if err != nil {
+		return err
+	}
+
+	return writer.flush()
+}
+
+// exportDevices reads every device before writing the first one, the fleet is held in memory by the server anyway
+func (p *PlutoServer) exportDevices(writer *exportWriter) error {
+	rows, err := p.Db.Query("SELECT " + deviceColumns + " FROM devices ORDER BY registered_at, ip")
+	if err != nil {
+		return fmt.Errorf("failed to query devices for export: %v", err)
+	}
+
+	var devices []Device
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan device: %v", err)
+		}
+		devices = append(devices, device)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read devices for export: %v", err)
+	}
+
+	for _, device := range devices {
+		fields := []string{device.IP, device.Serial, device.Model, strconv.Itoa(device.CurrentCount),
+			strconv.Itoa(device.TotalCount), strconv.Itoa(device.Threshold), exportTime(device.RegisteredAt),
+			exportTime(device.LastSeen), exportTime(device.LastMaintenance), exportTime(device.DecommissionedAt),
+			device.Site}
+		if err := writer.write(fields, device); err != nil {
+			return fmt.Errorf("failed to write devices export: %v", err)
+		}
+	}
+	return nil
+}
+
+func (p *PlutoServer) exportLogs(writer *exportWriter, q ExportQuery) error {
+	var after int64
+	for {
+		timeFilter, args := logTimeFilter(q.From, q.To)
+		rows, err := p.Db.Query("SELECT "+logColumns+" FROM logs WHERE id > ?"+timeFilter+" ORDER BY id LIMIT ?",
+			append(append([]any{after}, args...), exportBatchSize)...)
+		if err != nil {
+			return fmt.Errorf("failed to query logs for export: %v", err)
+		}
+
+		var entries []LogEntry
+		for rows.Next() {
+			entry, err := scanLogEntry(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read logs for export: %v", err)
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		for _, entry := range entries {
+			fields := []string{strconv.FormatInt(entry.ID, 10), entry.DeviceIP, entry.Action,
+				strconv.Itoa(entry.CountValue), exportTime(entry.Timestamp), strconv.Itoa(entry.Response)}
+			if err := writer.write(fields, entry); err != nil {
+				return fmt.Errorf("failed to write logs export: %v", err)
+			}
+		}
+		after = entries[len(entries)-1].ID
+	}
+}
+
+func (p *PlutoServer) exportMaintenance(writer *exportWriter, q ExportQuery) error {
+	var after int64
+	for {
+		rows, err := p.Db.Query("SELECT "+maintenanceColumns+" FROM maintenance_records WHERE id > ? ORDER BY id LIMIT ?",
+			after, exportBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to query maintenance for export: %v", err)
+		}
+
+		var records []MaintenanceRecord
+		for rows.Next() {
+			record, err := scanMaintenanceRecord(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			records = append(records, record)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read maintenance for export: %v", err)
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		for _, record := range records {
+			if !q.inRange(record.PerformedAt) {
+				continue
+			}
+			fields := []string{strconv.FormatInt(record.ID, 10), record.DeviceIP, exportTime(record.PerformedAt),
+				strconv.Itoa(record.CountAtReset), record.Technician, record.Kind, record.Notes}
+			if err := writer.write(fields, record); err != nil {
+				return fmt.Errorf("failed to write maintenance export: %v", err)
+			}
+		}
+		after = records[len(records)-1].ID
+	}
+}
+
+// exportTime renders timestamps as RFC3339 and zero timestamps as empty fields
+func exportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
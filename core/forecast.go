@@ -0,0 +1,122 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultForecastWindowDays is the span of increment history the firing rate is computed from
+const DefaultForecastWindowDays = 14
+
+// Forecast projects when a device will reach its maintenance threshold at its recent firing rate
+type Forecast struct {
+	IP            string     `json:"ip"`
+	CurrentCount  int        `json:"current_count"`
+	Threshold     int        `json:"threshold"`
+	DailyRate     float64    `json:"daily_rate"`     // Average triggers per day over the forecast window
+	DaysRemaining *float64   `json:"days_remaining"` // Days until the threshold is reached, null for idle devices
+	ProjectedDate *time.Time `json:"projected_date"` // Date the threshold is reached, null for idle devices
+}
+
+// Forecasts projects the threshold date of every device from the increments logged in the last windowDays days.
+// Devices that already reached their threshold are projected for now, idle devices have no projection.
+// The result is sorted by projected date, idle devices last.
+func (p *PlutoServer) Forecasts(windowDays int) ([]Forecast, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.forecasts(windowDays)
+}
+
+// forecasts implements Forecasts, the caller holds p.mu
+func (p *PlutoServer) forecasts(windowDays int) ([]Forecast, error) {
+	if windowDays <= 0 {
+		return nil, fmt.Errorf("%w: forecast window must be positive", ErrInvalidInput)
+	}
+
+	now := time.Now()
+	windowStart := now.AddDate(0, 0, -windowDays)
+
+	fired, err := p.incrementsSince(windowStart)
+	if err != nil {
+		return nil, err
+	}
+
+	forecasts := make([]Forecast, 0, len(p.Devices))
+	for _, device := range p.Devices {
+		if device.decommissioned() {
+			continue
+		}
+
+		forecast := Forecast{
+			IP:           device.IP,
+			CurrentCount: device.CurrentCount,
+			Threshold:    p.thresholdFor(device),
+		}
+
+		// Devices registered within the window are rated over the time they actually existed
+		span := now.Sub(windowStart)
+		if device.RegisteredAt.After(windowStart) {
+			span = max(now.Sub(device.RegisteredAt), 24*time.Hour)
+		}
+		forecast.DailyRate = float64(fired[device.IP]) / span.Hours() * 24
+
+		remaining := forecast.Threshold - forecast.CurrentCount
+		switch {
+		case remaining <= 0:
+			days := 0.0
+			forecast.DaysRemaining = &days
+			forecast.ProjectedDate = &now
+		case forecast.DailyRate > 0:
+			days := float64(remaining) / forecast.DailyRate
+			projected := now.Add(time.Duration(days * float64(24*time.Hour)))
+			forecast.DaysRemaining = &days
+			forecast.ProjectedDate = &projected
+		}
+
+		forecasts = append(forecasts, forecast)
+	}
+
+	sort.Slice(forecasts, func(i, j int) bool {
+		a, b := forecasts[i].ProjectedDate, forecasts[j].ProjectedDate
+		switch {
+		case a != nil && b != nil && !a.Equal(*b):
+			return a.Before(*b)
+		case (a == nil) != (b == nil):
+			return a != nil
+		default:
+			return forecasts[i].IP < forecasts[j].IP
+		}
+	})
+
+	return forecasts, nil
+}
+
+// incrementsSince sums the logged increments of every device since a point in time
+func (p *PlutoServer) incrementsSince(since time.Time) (map[string]int, error) {
+	timeFilter, args := logTimeFilter(since, time.Time{})
+	rows, err := p.Db.Query("SELECT device_ip, action FROM logs WHERE action LIKE 'increment+%'"+timeFilter, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query increment history: %v", err)
+	}
+	defer rows.Close()
+
+	fired := make(map[string]int)
+	for rows.Next() {
+		var deviceIP, action string
+		if err := rows.Scan(&deviceIP, &action); err != nil {
+			return nil, fmt.Errorf("failed to scan increment history: %v", err)
+		}
+
+		increment, err := strconv.Atoi(strings.TrimPrefix(action, "increment+"))
+		if err != nil {
+			continue
+		}
+		fired[deviceIP] += increment
+	}
+
+	return fired, rows.Err()
+}
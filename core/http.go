@@ -1,82 +1,793 @@
 package core
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func (p *PlutoServer) StartHTTPReloadServer(port int) {
-	http.HandleFunc("/reload", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "POST" {
-			http.Error(w, "Method not allowed - use POST", http.StatusMethodNotAllowed)
-			return
+func (p *PlutoServer) StartHTTPReloadServer(port int) error {
+	tlsConfig, err := p.TLSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to configure TLS: %v", err)
+	}
+	server := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: p.HTTPHandler(), TLSConfig: tlsConfig}
+
+	var active int
+	if err := p.Db.QueryRow("SELECT COUNT(*) FROM api_tokens WHERE revoked_at IS NULL").Scan(&active); err != nil {
+		log.Printf("Failed to count API tokens: %v", err)
+	} else if active == 0 {
+		log.Println("Warning: no API token issued, every API request is rejected until one is (pluto token -role admin issue NAME)")
+	}
+
+	scheme := "HTTPS"
+	if tlsConfig == nil {
+		scheme = "HTTP"
+		log.Println("Warning: TLS is disabled, API tokens and maintenance calls cross the network unencrypted")
+	}
+
+	// The port is bound here, so a port in use stops the start instead of leaving the server without its API
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on HTTP port %d: %v", port, err)
+	}
+	log.Printf("%s reload API server starting on port %d (endpoints: POST /reload, /devices, /models, /work-orders, /api/v1, dashboard at /ui/)", scheme, port)
+
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
 		}
+		log.Printf("HTTP reload server error: %v", err)
+	}()
+
+	return nil
+}
+
+// HTTPHandler returns the administrative API routes and the web dashboard without binding them to a port. Every API
+// route requires an API token, routes that change state also require a role. Viewers may use the routes that are not
+// wrapped in requireRole.
+func (p *PlutoServer) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	for _, route := range p.httpRoutes() {
+		mux.HandleFunc(route.pattern, route.handler)
+	}
+	return p.requireToken(mux)
+}
+
+// HTTPRoutes returns the patterns served by HTTPHandler, in http.ServeMux syntax
+func (p *PlutoServer) HTTPRoutes() []string {
+	var patterns []string
+	for _, route := range p.httpRoutes() {
+		patterns = append(patterns, route.pattern)
+	}
+	return patterns
+}
+
+// httpRoute is a pattern of HTTPHandler and the handler serving it
+type httpRoute struct {
+	pattern string
+	handler http.HandlerFunc
+}
+
+// httpRoutes lists the routes of HTTPHandler, every API route is documented in openapi.json
+func (p *PlutoServer) httpRoutes() []httpRoute {
+	return []httpRoute{
+		{"/reload", requireRole(RoleAdmin, p.handleReload)},
+		{"POST /devices/{ip}/maintenance", requireRole(RoleTechnician, p.handleMaintenance)},
+		{"GET /devices/{ip}/maintenance", p.handleMaintenanceTimeline},
+		{"PUT /devices/{ip}/threshold", requireRole(RoleAdmin, p.handleDeviceThreshold)},
+		{"PUT /devices/{ip}/model", requireRole(RoleAdmin, p.handleDeviceModel)},
+		{"PUT /devices/{ip}/site", requireRole(RoleAdmin, p.handleDeviceSite)},
+		{"GET /devices/{ip}/exemptions", p.handleExemptions},
+		{"POST /devices/{ip}/exemptions", requireRole(RoleAdmin, p.handleGrantExemption)},
+		{"DELETE /devices/{ip}/exemptions", requireRole(RoleAdmin, p.handleRevokeExemption)},
+		{"GET /devices/{ip}/deferrals", p.handleDeferrals},
+		{"POST /devices/{ip}/deferrals", requireRole(RoleAdmin, p.handleDeferMaintenance)},
+		{"DELETE /devices/{ip}/deferrals", requireRole(RoleAdmin, p.handleCancelDeferral)},
+		{"GET /models", p.handleModels},
+		{"PUT /models/{name}", requireRole(RoleAdmin, p.handleSaveModel)},
+		{"DELETE /models/{name}", requireRole(RoleAdmin, p.handleDeleteModel)},
+		{"GET /forecasts", p.handleForecasts},
+		{"GET /work-orders", p.handleWorkOrders},
+		{"GET /work-orders/{id}", p.handleWorkOrder},
+		{"POST /work-orders/{id}/{action}", requireRole(RoleTechnician, p.handleWorkOrderTransition)},
+
+		{"GET /api/v1/devices", p.handleAPIDevices},
+		{"POST /api/v1/devices/import", requireRole(RoleAdmin, p.handleAPIImport)},
+		{"GET /api/v1/devices/{ip}", p.handleAPIDevice},
+		{"DELETE /api/v1/devices/{ip}", requireRole(RoleAdmin, p.handleAPIPurgeDevice)},
+		{"POST /api/v1/devices/{ip}/decommission", requireRole(RoleAdmin, p.handleAPIDecommission)},
+		{"GET /api/v1/audit", p.handleAPIAudit},
+		{"GET /api/v1/logs", p.handleAPILogs},
+		{"GET /api/v1/stats", p.handleAPIStats},
+		{"GET /api/v1/settings", p.handleAPISettings},
+		{"PUT /api/v1/settings/threshold", requireRole(RoleAdmin, p.handleAPISetThreshold)},
+		{"DELETE /api/v1/settings/threshold", requireRole(RoleAdmin, p.handleAPIClearThreshold)},
+		{"POST /api/v1/database/rekey", requireRole(RoleAdmin, p.handleAPIRekey)},
+		{"GET /api/v1/export/{dataset}", p.handleAPIExport},
+		{"GET /api/v1/events", p.handleAPIEvents},
+		{"GET /api/v1/openapi.json", p.handleOpenAPI},
+
+		{"GET /ui/", uiHandler().ServeHTTP},
+		{"GET /{$}", handleUIRedirect},
+	}
+}
+
+func (p *PlutoServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed - use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	log.Println("Manual device reload triggered via HTTP API")
 
-		log.Println("Manual device reload triggered via HTTP API")
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-		rows, err := p.Db.Query("SELECT ip, current_count, total_count, last_seen, registered_at FROM devices")
+	if err := p.loadModels(); err != nil {
+		log.Printf("Error reloading device models from database: %v", err)
+		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := p.Db.Query("SELECT " + deviceColumns + " FROM devices")
+	if err != nil {
+		log.Printf("Error reloading devices from database: %v", err)
+		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	updatedCount := 0
+	errorCount := 0
+
+	for rows.Next() {
+		device, err := scanDevice(rows)
 		if err != nil {
-			log.Printf("Error reloading devices from database: %v", err)
-			http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
+			log.Printf("Error scanning device row during reload: %v", err)
+			errorCount++
+			continue
+		}
+
+		if existingDevice, exists := p.Devices[device.IP]; exists {
+			if existingDevice.CurrentCount != device.CurrentCount || existingDevice.TotalCount != device.TotalCount {
+				log.Printf("Updating device %s: current %d->%d, total %d->%d",
+					device.IP, existingDevice.CurrentCount, device.CurrentCount,
+					existingDevice.TotalCount, device.TotalCount)
+			}
+		} else {
+			log.Printf("Loading device %s: current=%d, total=%d", device.IP, device.CurrentCount, device.TotalCount)
+		}
+
+		p.Devices[device.IP] = &device
+		updatedCount++
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error during device reload iteration: %v", err)
+		http.Error(w, fmt.Sprintf("Database iteration failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := p.loadExemptions(); err != nil {
+		log.Printf("Error reloading lockout exemptions from database: %v", err)
+		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := p.loadDeferrals(); err != nil {
+		log.Printf("Error reloading maintenance deferrals from database: %v", err)
+		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	responseMsg := fmt.Sprintf("Device reload completed successfully. Processed: %d devices", updatedCount)
+	if errorCount > 0 {
+		responseMsg += fmt.Sprintf(" (with %d errors - check logs)", errorCount)
+	}
+
+	log.Printf("Device reload completed: %d devices processed, %d errors", updatedCount, errorCount)
+	p.publish(Event{Type: EventReload, Devices: updatedCount})
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(responseMsg))
+}
+
+func (p *PlutoServer) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	deviceIP := r.PathValue("ip")
+	if !p.requireSite(w, r, deviceIP) {
+		return
+	}
+
+	var record MaintenanceRecord
+	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	device, err := p.RecordMaintenance(deviceIP, record)
+	if err != nil {
+		writeError(w, "Maintenance failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, device)
+}
+
+func (p *PlutoServer) handleMaintenanceTimeline(w http.ResponseWriter, r *http.Request) {
+	timeline, err := p.DeviceTimeline(r.PathValue("ip"))
+	if err != nil {
+		writeError(w, "Maintenance history unavailable", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, timeline)
+}
+
+func (p *PlutoServer) handleDeviceThreshold(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Threshold *int `json:"threshold"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if body.Threshold == nil {
+		http.Error(w, "threshold is required (0 restores the global threshold)", http.StatusBadRequest)
+		return
+	}
+
+	device, err := p.SetDeviceThreshold(r.PathValue("ip"), *body.Threshold)
+	if err != nil {
+		writeError(w, "Threshold update failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, device)
+}
+
+func (p *PlutoServer) handleDeviceModel(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	device, err := p.AssignModel(r.PathValue("ip"), body.Model)
+	if err != nil {
+		writeError(w, "Model assignment failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, device)
+}
+
+func (p *PlutoServer) handleDeviceSite(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Site string `json:"site"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	device, err := p.AssignSite(r.PathValue("ip"), body.Site)
+	if err != nil {
+		writeError(w, "Site assignment failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, device)
+}
+
+func (p *PlutoServer) handleExemptions(w http.ResponseWriter, r *http.Request) {
+	exemptions, err := p.Exemptions(r.PathValue("ip"))
+	if err != nil {
+		writeError(w, "Exemption query failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, exemptions)
+}
+
+func (p *PlutoServer) handleGrantExemption(w http.ResponseWriter, r *http.Request) {
+	var exemption LockoutExemption
+	if err := json.NewDecoder(r.Body).Decode(&exemption); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	exemption, err := p.GrantExemption(r.PathValue("ip"), exemption)
+	if err != nil {
+		writeError(w, "Exemption failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, exemption)
+}
+
+func (p *PlutoServer) handleRevokeExemption(w http.ResponseWriter, r *http.Request) {
+	if err := p.RevokeExemption(r.PathValue("ip")); err != nil {
+		writeError(w, "Exemption revocation failed", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *PlutoServer) handleDeferrals(w http.ResponseWriter, r *http.Request) {
+	deferrals, err := p.Deferrals(r.PathValue("ip"))
+	if err != nil {
+		writeError(w, "Deferral query failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deferrals)
+}
+
+func (p *PlutoServer) handleDeferMaintenance(w http.ResponseWriter, r *http.Request) {
+	var deferral MaintenanceDeferral
+	if err := json.NewDecoder(r.Body).Decode(&deferral); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	deferral, err := p.DeferMaintenance(r.PathValue("ip"), deferral)
+	if err != nil {
+		writeError(w, "Deferral failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, deferral)
+}
+
+func (p *PlutoServer) handleCancelDeferral(w http.ResponseWriter, r *http.Request) {
+	if err := p.CancelDeferral(r.PathValue("ip")); err != nil {
+		writeError(w, "Deferral cancellation failed", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *PlutoServer) handleModels(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, p.DeviceModels())
+}
+
+func (p *PlutoServer) handleSaveModel(w http.ResponseWriter, r *http.Request) {
+	var model DeviceModel
+	if err := json.NewDecoder(r.Body).Decode(&model); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	model.Name = r.PathValue("name")
+
+	model, err := p.SaveModel(model)
+	if err != nil {
+		writeError(w, "Model update failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model)
+}
+
+func (p *PlutoServer) handleDeleteModel(w http.ResponseWriter, r *http.Request) {
+	if err := p.DeleteModel(r.PathValue("name")); err != nil {
+		writeError(w, "Model deletion failed", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *PlutoServer) handleForecasts(w http.ResponseWriter, r *http.Request) {
+	windowDays := DefaultForecastWindowDays
+	if value := r.URL.Query().Get("window_days"); value != "" {
+		var err error
+		if windowDays, err = strconv.Atoi(value); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid window_days: %s", value), http.StatusBadRequest)
 			return
 		}
-		defer rows.Close()
+	}
 
-		updatedCount := 0
-		errorCount := 0
+	forecasts, err := p.Forecasts(windowDays)
+	if err != nil {
+		writeError(w, "Forecast failed", err)
+		return
+	}
 
-		for rows.Next() {
-			var device Device
-			var lastSeen, registeredAt string
+	writeJSON(w, http.StatusOK, forecasts)
+}
 
-			err := rows.Scan(&device.IP, &device.CurrentCount, &device.TotalCount, &lastSeen, &registeredAt)
-			if err != nil {
-				log.Printf("Error scanning device row during reload: %v", err)
-				errorCount++
-				continue
-			}
+func (p *PlutoServer) handleWorkOrders(w http.ResponseWriter, r *http.Request) {
+	orders, err := p.WorkOrders(r.URL.Query().Get("status"), r.URL.Query().Get("device"))
+	if err != nil {
+		writeError(w, "Work order query failed", err)
+		return
+	}
 
-			device.LastSeen = parseTime(lastSeen)
-			device.RegisteredAt = parseTime(registeredAt)
-
-			if existingDevice, exists := p.Devices[device.IP]; exists {
-				if existingDevice.CurrentCount != device.CurrentCount || existingDevice.TotalCount != device.TotalCount {
-					log.Printf("Updating device %s: current %d->%d, total %d->%d",
-						device.IP, existingDevice.CurrentCount, device.CurrentCount,
-						existingDevice.TotalCount, device.TotalCount)
-				}
-			} else {
-				log.Printf("Loading device %s: current=%d, total=%d", device.IP, device.CurrentCount, device.TotalCount)
-			}
+	writeJSON(w, http.StatusOK, orders)
+}
+
+func (p *PlutoServer) handleWorkOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid work order id: %s", r.PathValue("id")), http.StatusBadRequest)
+		return
+	}
+
+	order, err := p.WorkOrder(id)
+	if err != nil {
+		writeError(w, "Work order query failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, order)
+}
+
+func (p *PlutoServer) handleWorkOrderTransition(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid work order id: %s", r.PathValue("id")), http.StatusBadRequest)
+		return
+	}
+
+	order, err := p.WorkOrder(id)
+	if err != nil {
+		writeError(w, "Work order update failed", err)
+		return
+	}
+	if !p.requireSite(w, r, order.DeviceIP) {
+		return
+	}
+
+	// assign takes an assignee, complete takes the maintenance record fields; start has no body
+	var body struct {
+		Assignee string `json:"assignee"`
+		MaintenanceRecord
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch r.PathValue("action") {
+	case "assign":
+		order, err = p.AssignWorkOrder(id, body.Assignee)
+	case "start":
+		order, err = p.StartWorkOrder(id)
+	case "complete":
+		order, err = p.CompleteWorkOrder(id, body.MaintenanceRecord)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		writeError(w, "Work order update failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, order)
+}
+
+// handleAPIDevices lists device statuses, optionally filtered by maintenance status and model
+func (p *PlutoServer) handleAPIDevices(w http.ResponseWriter, r *http.Request) {
+	statusFilter := r.URL.Query().Get("status")
+	modelFilter, filterModel := r.URL.Query()["model"]
 
-			p.Devices[device.IP] = &device
-			updatedCount++
+	statuses := []DeviceStatus{}
+	for _, status := range p.DeviceStatuses() {
+		if statusFilter != "" && status.Status.String() != statusFilter {
+			continue
 		}
+		if filterModel && status.Model != modelFilter[0] {
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (p *PlutoServer) handleAPIDevice(w http.ResponseWriter, r *http.Request) {
+	status, err := p.DeviceStatusOf(r.PathValue("ip"))
+	if err != nil {
+		writeError(w, "Device query failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleAPIImport registers the devices of a CSV request body, or only validates them with dry_run=true. Invalid rows
+// are reported in the JSON result with status 400.
+func (p *PlutoServer) handleAPIImport(w http.ResponseWriter, r *http.Request) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	result, err := p.ImportDevices(http.MaxBytesReader(w, r.Body, MaxImportSize), dryRun)
+	if err != nil {
+		writeError(w, "Import failed", err)
+		return
+	}
+
+	switch {
+	case len(result.Errors) > 0:
+		writeJSON(w, http.StatusBadRequest, result)
+	case dryRun:
+		writeJSON(w, http.StatusOK, result)
+	default:
+		writeJSON(w, http.StatusCreated, result)
+	}
+}
+
+// auditedRequest is the body of the audited device operations
+type auditedRequest struct {
+	Actor  string `json:"actor"` // Defaults to the name of the request's API token
+	Reason string `json:"reason"`
+}
+
+// actor returns the person or client to record in the audit log
+func (b auditedRequest) actor(r *http.Request) string {
+	if token, ok := caller(r); ok && strings.TrimSpace(b.Actor) == "" {
+		return token.Name
+	}
+	return b.Actor
+}
+
+func (p *PlutoServer) handleAPIDecommission(w http.ResponseWriter, r *http.Request) {
+	var body auditedRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	device, err := p.DecommissionDevice(r.PathValue("ip"), body.actor(r), body.Reason)
+	if err != nil {
+		writeError(w, "Decommission failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, device)
+}
+
+func (p *PlutoServer) handleAPIPurgeDevice(w http.ResponseWriter, r *http.Request) {
+	var body auditedRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := p.PurgeDevice(r.PathValue("ip"), body.actor(r), body.Reason); err != nil {
+		writeError(w, "Purge failed", err)
+		return
+	}
 
-		if err := rows.Err(); err != nil {
-			log.Printf("Error during device reload iteration: %v", err)
-			http.Error(w, fmt.Sprintf("Database iteration failed: %v", err), http.StatusInternalServerError)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *PlutoServer) handleAPIAudit(w http.ResponseWriter, r *http.Request) {
+	entries, err := p.AuditLog(r.URL.Query().Get("device"))
+	if err != nil {
+		writeError(w, "Audit query failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (p *PlutoServer) handleAPIStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, p.Stats())
+}
+
+// handleAPILogs serves a page of the event log as JSON, or as CSV with format=csv. The CSV variant carries the next
+// cursor in the X-Next-Cursor header.
+func (p *PlutoServer) handleAPILogs(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := LogQuery{
+		DeviceIP: params.Get("device"),
+		Action:   params.Get("action"),
+	}
+
+	var err error
+	for name, target := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if value := params.Get(name); value != "" {
+			if *target, err = time.Parse(time.RFC3339, value); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s, expected RFC3339: %s", name, value), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if value := params.Get("limit"); value != "" {
+		if q.Limit, err = strconv.Atoi(value); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid limit: %s", value), http.StatusBadRequest)
 			return
 		}
+	}
+	if value := params.Get("cursor"); value != "" {
+		if q.Cursor, err = strconv.ParseInt(value, 10, 64); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid cursor: %s", value), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := params.Get("response"); value != "" {
+		response, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid response: %s", value), http.StatusBadRequest)
+			return
+		}
+		q.Response = &response
+	}
+
+	page, err := p.QueryLogs(q)
+	if err != nil {
+		writeError(w, "Log query failed", err)
+		return
+	}
 
-		responseMsg := fmt.Sprintf("Device reload completed successfully. Processed: %d devices", updatedCount)
-		if errorCount > 0 {
-			responseMsg += fmt.Sprintf(" (with %d errors - check logs)", errorCount)
+	switch params.Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, page)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("X-Next-Cursor", strconv.FormatInt(page.NextCursor, 10))
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"id", "device_ip", "action", "count_value", "timestamp", "response"})
+		for _, entry := range page.Entries {
+			writer.Write([]string{
+				strconv.FormatInt(entry.ID, 10), entry.DeviceIP, entry.Action, strconv.Itoa(entry.CountValue),
+				entry.Timestamp.Format(time.RFC3339), strconv.Itoa(entry.Response),
+			})
 		}
+		writer.Flush()
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported format: %s (use json or csv)", params.Get("format")), http.StatusBadRequest)
+	}
+}
 
-		log.Printf("Device reload completed: %d devices processed, %d errors", updatedCount, errorCount)
+func (p *PlutoServer) handleAPISettings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, p.Settings())
+}
 
-		w.Header().Set("Content-Type", "text/plain")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(responseMsg))
-	})
+func (p *PlutoServer) handleAPISetThreshold(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Threshold int `json:"threshold"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
 
-	log.Printf("HTTP reload API server starting on port %d (endpoint: POST /reload)", port)
+	change, err := p.SetThreshold(body.Threshold)
+	if err != nil {
+		writeError(w, "Threshold update failed", err)
+		return
+	}
 
-	go func() {
-		if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); err != nil {
-			log.Printf("HTTP reload server error: %v", err)
+	writeJSON(w, http.StatusOK, change)
+}
+
+// handleAPIClearThreshold returns to the threshold the server was started with
+func (p *PlutoServer) handleAPIClearThreshold(w http.ResponseWriter, r *http.Request) {
+	change, err := p.ClearThreshold()
+	if err != nil {
+		writeError(w, "Threshold reset failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, change)
+}
+
+// handleAPIRekey rotates the database key. The new key is only accepted over HTTPS or from the host itself, so it
+// never crosses the network in clear text.
+func (p *PlutoServer) handleAPIRekey(w http.ResponseWriter, r *http.Request) {
+	if r.TLS == nil && !fromLoopback(r) {
+		token, _ := caller(r)
+		forbidRequest(w, r, token, "database keys are only accepted over HTTPS or from localhost")
+		return
+	}
+
+	var body struct {
+		NewKey     string `json:"new_key"`
+		KeepBackup bool   `json:"keep_backup"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	token, _ := caller(r)
+	log.Printf("Database key rotation requested by %s", token.Name)
+
+	result, err := p.Rekey(body.NewKey, body.KeepBackup)
+	if err != nil {
+		writeError(w, "Database key rotation failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func fromLoopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleAPIExport streams a dataset as a CSV or NDJSON download. Errors after the first row cannot change the status
+// any more, they are logged and end the download early.
+func (p *PlutoServer) handleAPIExport(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := ExportQuery{Dataset: r.PathValue("dataset"), Format: params.Get("format")}
+
+	var err error
+	for name, target := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if value := params.Get(name); value != "" {
+			if *target, err = time.Parse(time.RFC3339, value); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s, expected RFC3339: %s", name, value), http.StatusBadRequest)
+				return
+			}
 		}
-	}()
+	}
+	if err := q.validate(); err != nil {
+		writeError(w, "Export failed", err)
+		return
+	}
+
+	contentType := "text/csv"
+	if q.Format == ExportNDJSON {
+		contentType = "application/x-ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="pluto-%s-%s.%s"`,
+		q.Dataset, time.Now().Format("20060102"), q.Format))
+
+	if err := p.Export(w, q); err != nil {
+		log.Printf("Export of %s failed: %v", q.Dataset, err)
+	}
+}
+
+// writeError maps errors returned by the server API onto HTTP status codes
+func writeError(w http.ResponseWriter, context string, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, fmt.Sprintf("%s: the request body is larger than %d bytes", context, tooLarge.Limit),
+			http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrDeviceNotFound), errors.Is(err, ErrWorkOrderNotFound), errors.Is(err, ErrModelNotFound),
+		errors.Is(err, ErrNoActiveExemption), errors.Is(err, ErrNoActiveDeferral):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalidInput):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidTransition), errors.Is(err, ErrModelInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("%s: %v", context, err)
+		http.Error(w, fmt.Sprintf("%s: %v", context, err), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
 }
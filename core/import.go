@@ -0,0 +1,219 @@
+package core
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxImportSize is the largest CSV body accepted by the import API, enough for tens of thousands of devices
+const MaxImportSize = 8 << 20
+
+// importColumns are the columns accepted in a device import, only ip is required
+var importColumns = []string{"ip", "serial", "model", "site", "current_count", "total_count"}
+
+// ImportResult reports the outcome of a device import
+type ImportResult struct {
+	DryRun  bool          `json:"dry_run"`
+	Devices []Device      `json:"devices"` // Devices registered by the import, or that would be on a dry run
+	Errors  []ImportError `json:"errors"`  // Invalid rows, nothing is registered when there are any
+}
+
+// ImportError describes an invalid row of a device import
+type ImportError struct {
+	Line    int    `json:"line"` // Line of the row in the CSV file, the header is line 1
+	Message string `json:"message"`
+}
+
+// ImportDevices pre-registers devices from a CSV file with a header row naming its columns out of ip, serial, model,
+// site, current_count and total_count. Every row is validated first and the devices are only registered, in a single
+// transaction, when all rows are valid. A dry run validates the rows without registering anything. Units migrated
+// from another tracker keep their total count, which defaults to the current count. Imported devices count as seen at
+// the time of the import, units that arrive due get a work order.
+func (p *PlutoServer) ImportDevices(r io.Reader, dryRun bool) (ImportResult, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1 // Missing trailing fields are left empty
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return ImportResult{}, fmt.Errorf("%w: the import file is empty", ErrInvalidInput)
+	}
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("%w: failed to read the header row: %w", ErrInvalidInput, err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(importColumns, name) {
+			return ImportResult{}, fmt.Errorf("%w: unknown column %q (expected %s)", ErrInvalidInput, name,
+				strings.Join(importColumns, ", "))
+		}
+		if _, duplicate := columns[name]; duplicate {
+			return ImportResult{}, fmt.Errorf("%w: duplicate column %q", ErrInvalidInput, name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["ip"]; !ok {
+		return ImportResult{}, fmt.Errorf("%w: the ip column is required", ErrInvalidInput)
+	}
+
+	// The rows are read and checked before taking the lock, a slow upload must not hold up the devices
+	result := ImportResult{DryRun: dryRun, Devices: []Device{}, Errors: []ImportError{}}
+	now := time.Now()
+
+	var rows []importedRow
+	ips := make(map[string]bool)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ImportResult{}, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		device, err := parseImportRow(record, columns, now)
+		if err == nil && ips[device.IP] {
+			err = fmt.Errorf("device %s is listed more than once", device.IP)
+		}
+		if err == nil {
+			ips[device.IP] = true
+		}
+		rows = append(rows, importedRow{line: line, device: device, err: err})
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	serials := make(map[string]string)
+	for _, device := range p.Devices {
+		if device.Serial != "" {
+			serials[device.Serial] = device.IP
+		}
+	}
+
+	for _, row := range rows {
+		err := row.err
+		if err == nil {
+			err = p.importConflict(row.device)
+		}
+		if err == nil && row.device.Serial != "" && serials[row.device.Serial] != "" {
+			err = fmt.Errorf("serial %s is already used by device %s", row.device.Serial, serials[row.device.Serial])
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, ImportError{Line: row.line, Message: err.Error()})
+			continue
+		}
+
+		if row.device.Serial != "" {
+			serials[row.device.Serial] = row.device.IP
+		}
+		result.Devices = append(result.Devices, row.device)
+	}
+
+	if len(result.Errors) > 0 || dryRun {
+		return result, nil
+	}
+
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("failed to begin import transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for i := range result.Devices {
+		if err := saveDevice(tx, &result.Devices[i]); err != nil {
+			return ImportResult{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ImportResult{}, fmt.Errorf("failed to commit device import: %v", err)
+	}
+
+	for i := range result.Devices {
+		device := result.Devices[i]
+		p.Devices[device.IP] = &device
+
+		// Units migrated past their threshold get a work order right away
+		p.checkCrossing(&device, LevelNormal)
+	}
+	log.Printf("Imported %d devices", len(result.Devices))
+
+	return result, nil
+}
+
+// importedRow is a parsed row of a device import, with the reason it is invalid if any
+type importedRow struct {
+	line   int
+	device Device
+	err    error
+}
+
+// parseImportRow validates the fields of a single row of a device import
+func parseImportRow(record []string, columns map[string]int, now time.Time) (Device, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	device := Device{
+		IP:           field("ip"),
+		Serial:       field("serial"),
+		Model:        field("model"),
+		Site:         field("site"),
+		LastSeen:     now,
+		RegisteredAt: now,
+	}
+
+	// Stored the way the UDP handler names the sender, so the unit is not registered a second time on startup
+	ip := net.ParseIP(device.IP)
+	if ip == nil {
+		return Device{}, fmt.Errorf("invalid ip %q", device.IP)
+	}
+	device.IP = ip.String()
+	if strings.Contains(device.Site, ",") {
+		return Device{}, fmt.Errorf("invalid site %q, site names cannot contain commas", device.Site)
+	}
+
+	var err error
+	if value := field("current_count"); value != "" {
+		if device.CurrentCount, err = strconv.Atoi(value); err != nil || device.CurrentCount < 0 {
+			return Device{}, fmt.Errorf("invalid current_count %q", value)
+		}
+	}
+	device.TotalCount = device.CurrentCount
+	if value := field("total_count"); value != "" {
+		if device.TotalCount, err = strconv.Atoi(value); err != nil || device.TotalCount < 0 {
+			return Device{}, fmt.Errorf("invalid total_count %q", value)
+		}
+	}
+	if device.TotalCount < device.CurrentCount {
+		return Device{}, fmt.Errorf("total_count %d is below current_count %d", device.TotalCount, device.CurrentCount)
+	}
+
+	return device, nil
+}
+
+// importConflict checks a parsed row against the registered devices and models, the caller holds p.mu
+func (p *PlutoServer) importConflict(device Device) error {
+	if _, exists := p.Devices[device.IP]; exists {
+		return fmt.Errorf("device %s is already registered", device.IP)
+	}
+	if _, exists := p.Models[device.Model]; device.Model != "" && !exists {
+		return fmt.Errorf("unknown model %q", device.Model)
+	}
+	return nil
+}
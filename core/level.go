@@ -0,0 +1,231 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// MaintenanceLevel grades how close a device is to, or how far past, its maintenance threshold
+type MaintenanceLevel int
+
+const (
+	LevelNormal      MaintenanceLevel = iota // Below the warning percentage of the threshold
+	LevelApproaching                         // At or above WarningPercent of the threshold
+	LevelDue                                 // At or above the threshold
+	LevelOverdue                             // At or above the threshold plus GraceMargin
+	LevelLockout                             // At or above the threshold plus LockoutMargin without an active exemption
+)
+
+func (l MaintenanceLevel) String() string {
+	switch l {
+	case LevelApproaching:
+		return "approaching"
+	case LevelDue:
+		return "due"
+	case LevelOverdue:
+		return "overdue"
+	case LevelLockout:
+		return "lockout"
+	default:
+		return "normal"
+	}
+}
+
+func (l MaintenanceLevel) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *MaintenanceLevel) UnmarshalText(text []byte) error {
+	for level := LevelNormal; level <= LevelLockout; level++ {
+		if level.String() == string(text) {
+			*l = level
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown maintenance level %q", text)
+}
+
+// Response maps a level onto the value sent back to the device
+func (l MaintenanceLevel) Response() StartupResponse {
+	switch l {
+	case LevelApproaching:
+		return StartupResponseApproaching
+	case LevelDue:
+		return StartupResponseThresholdReached
+	case LevelOverdue:
+		return StartupResponseOverdue
+	case LevelLockout:
+		return StartupResponseLockout
+	default:
+		return StartupResponseNormal
+	}
+}
+
+// maintenancePolicy holds the limits that apply to a single device after resolving its overrides and model
+type maintenancePolicy struct {
+	Threshold      int
+	WarningPercent int
+	GraceMargin    int
+	LifetimeLimit  int // TotalCount after which the unit should be retired, 0 means unlimited
+	IntervalDays   int // Days between maintenance operations regardless of the count, 0 disables
+}
+
+// policyFor resolves the maintenance policy of a device. A device threshold override wins over its model, the model
+// wins over the server wide settings.
+func (p *PlutoServer) policyFor(device *Device) maintenancePolicy {
+	policy := maintenancePolicy{
+		Threshold:      p.Threshold,
+		WarningPercent: p.WarningPercent,
+		GraceMargin:    p.GraceMargin,
+		IntervalDays:   p.IntervalDays,
+	}
+
+	if model, exists := p.Models[device.Model]; exists {
+		policy.Threshold = model.Threshold
+		if model.WarningPercent > 0 {
+			policy.WarningPercent = model.WarningPercent
+		}
+		policy.LifetimeLimit = model.LifetimeLimit
+		if model.IntervalDays > 0 {
+			policy.IntervalDays = model.IntervalDays
+		}
+	}
+
+	if device.Threshold > 0 {
+		policy.Threshold = device.Threshold
+	}
+
+	return policy
+}
+
+// thresholdFor returns the maintenance threshold that applies to a device
+func (p *PlutoServer) thresholdFor(device *Device) int {
+	return p.policyFor(device).Threshold
+}
+
+// dueDate returns when the maintenance interval of a device elapses, counted from its last maintenance or, if it was
+// never serviced, its registration. The zero time means no interval applies.
+func (p *PlutoServer) dueDate(device *Device) time.Time {
+	intervalDays := p.policyFor(device).IntervalDays
+	if intervalDays <= 0 {
+		return time.Time{}
+	}
+
+	since := device.LastMaintenance
+	if since.IsZero() {
+		since = device.RegisteredAt
+	}
+	return since.AddDate(0, 0, intervalDays)
+}
+
+// levelAt evaluates the maintenance level of a device for a current trigger count. The count and the calendar are
+// graded separately and whichever limit is closer wins. A zero WarningPercent, GraceMargin or LockoutMargin disables
+// the approaching, overdue or lockout level respectively. An exempted device is at most overdue. Deferrals only hold
+// back the replies to the device, see deferred, so crossings during a deferral still open work orders. A decommissioned
+// device is always normal, so it gets no replies and no work orders.
+func (p *PlutoServer) levelAt(device *Device, count int) MaintenanceLevel {
+	if device.decommissioned() {
+		return LevelNormal
+	}
+
+	policy := p.policyFor(device)
+	now := time.Now()
+
+	level := LevelNormal
+	switch {
+	case p.LockoutMargin > 0 && count >= policy.Threshold+p.LockoutMargin && !device.exempt(now):
+		level = LevelLockout
+	case p.LockoutMargin > 0 && count >= policy.Threshold+p.LockoutMargin:
+		level = LevelOverdue
+	case policy.GraceMargin > 0 && count >= policy.Threshold+policy.GraceMargin:
+		level = LevelOverdue
+	case count >= policy.Threshold:
+		level = LevelDue
+	case policy.WarningPercent > 0 && count*100 >= policy.Threshold*policy.WarningPercent:
+		level = LevelApproaching
+	}
+
+	if calendarLevel := p.calendarLevel(device, policy, now); calendarLevel > level {
+		level = calendarLevel
+	}
+
+	return level
+}
+
+// calendarLevel grades a device by the time elapsed since its last maintenance
+func (p *PlutoServer) calendarLevel(device *Device, policy maintenancePolicy, now time.Time) MaintenanceLevel {
+	due := p.dueDate(device)
+	if due.IsZero() {
+		return LevelNormal
+	}
+	if !now.Before(due) {
+		return LevelDue
+	}
+
+	interval := time.Duration(policy.IntervalDays) * 24 * time.Hour
+	elapsed := interval - due.Sub(now)
+	if policy.WarningPercent > 0 && elapsed*100 >= interval*time.Duration(policy.WarningPercent) {
+		return LevelApproaching
+	}
+	return LevelNormal
+}
+
+// CheckCalendarDue opens work orders for devices whose maintenance interval has elapsed. Devices that are powered off
+// never send a packet that could trigger the check, so it runs periodically. It returns the number of opened orders.
+func (p *PlutoServer) CheckCalendarDue() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	opened := 0
+	for _, device := range p.Devices {
+		due := p.dueDate(device)
+		if due.IsZero() || now.Before(due) || device.decommissioned() {
+			continue
+		}
+
+		created, err := p.openWorkOrder(device, WorkOrderReasonCalendar)
+		if err != nil {
+			log.Printf("Error opening work order: %v", err)
+			continue
+		}
+		if created {
+			log.Printf("Device %s is due for calendar maintenance since %s (last seen: %s)",
+				device.IP, due.Format(time.DateOnly), device.LastSeen.Format(time.DateTime))
+			opened++
+		}
+	}
+
+	return opened
+}
+
+// lifetimeExceeded reports whether a device fired past the lifetime limit of its model
+func (p *PlutoServer) lifetimeExceeded(device *Device) bool {
+	limit := p.policyFor(device).LifetimeLimit
+	return limit > 0 && device.TotalCount >= limit
+}
+
+// checkCrossing opens a work order when a policy change or an import moved a device from below its threshold to at or
+// above it, and reports whether it did
+func (p *PlutoServer) checkCrossing(device *Device, oldLevel MaintenanceLevel) bool {
+	newLevel := p.levelAt(device, device.CurrentCount)
+	if oldLevel < LevelDue && newLevel >= LevelDue {
+		log.Printf("Device %s became due outside a count update (count: %d, threshold: %d)",
+			device.IP, device.CurrentCount, p.thresholdFor(device))
+
+		reason := WorkOrderReasonThreshold
+		if device.CurrentCount < p.thresholdFor(device) {
+			reason = WorkOrderReasonCalendar
+		}
+		if _, err := p.openWorkOrder(device, reason); err != nil {
+			log.Printf("Error opening work order: %v", err)
+		}
+
+		event := p.deviceEvent(EventThresholdCrossing, device, time.Now())
+		event.PreviousStatus = &oldLevel
+		p.publish(event)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+var ErrNoActiveExemption = errors.New("no active lockout exemption")
+
+// exempt reports whether the device may keep operating past the lockout margin at a point in time
+func (d *Device) exempt(at time.Time) bool {
+	return at.Before(d.ExemptUntil)
+}
+
+const exemptionColumns = "id, device_ip, granted_by, reason, granted_at, expires_at, revoked_at"
+
+// loadExemptions applies the active exemptions of the lockout_exemptions table to the in-memory devices.
+// The caller holds p.mu.
+func (p *PlutoServer) loadExemptions() error {
+	rows, err := p.Db.Query("SELECT " + exemptionColumns + " FROM lockout_exemptions WHERE revoked_at IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to load lockout exemptions: %v", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	for rows.Next() {
+		exemption, err := scanExemption(rows)
+		if err != nil {
+			return err
+		}
+
+		device, exists := p.Devices[exemption.DeviceIP]
+		if exists && now.Before(exemption.ExpiresAt) && exemption.ExpiresAt.After(device.ExemptUntil) {
+			device.ExemptUntil = exemption.ExpiresAt
+		}
+	}
+
+	return rows.Err()
+}
+
+// GrantExemption allows a device to keep operating past the lockout margin until ExpiresAt. GrantedBy and Reason are
+// required. A new exemption replaces any exemption that is still active.
+func (p *PlutoServer) GrantExemption(deviceIP string, exemption LockoutExemption) (LockoutExemption, error) {
+	exemption.GrantedBy = strings.TrimSpace(exemption.GrantedBy)
+	exemption.Reason = strings.TrimSpace(exemption.Reason)
+	now := time.Now()
+
+	switch {
+	case exemption.GrantedBy == "":
+		return LockoutExemption{}, fmt.Errorf("%w: granted_by is required", ErrInvalidInput)
+	case exemption.Reason == "":
+		return LockoutExemption{}, fmt.Errorf("%w: reason is required", ErrInvalidInput)
+	case !exemption.ExpiresAt.After(now):
+		return LockoutExemption{}, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidInput)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, exists := p.Devices[deviceIP]
+	if !exists {
+		return LockoutExemption{}, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceIP)
+	}
+
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return LockoutExemption{}, fmt.Errorf("failed to begin exemption transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := revokeExemptions(tx, deviceIP, now); err != nil {
+		return LockoutExemption{}, err
+	}
+
+	query := `
+	INSERT INTO lockout_exemptions (device_ip, granted_by, reason, granted_at, expires_at)
+	VALUES (?, ?, ?, ?, ?)`
+
+	exemption.DeviceIP = deviceIP
+	exemption.GrantedAt = now
+	exemption.RevokedAt = nil
+
+	result, err := tx.Exec(query, deviceIP, exemption.GrantedBy, exemption.Reason,
+		formatTime(exemption.GrantedAt), formatTime(exemption.ExpiresAt))
+	if err != nil {
+		return LockoutExemption{}, fmt.Errorf("failed to save lockout exemption for device %s: %v", deviceIP, err)
+	}
+	if exemption.ID, err = result.LastInsertId(); err != nil {
+		return LockoutExemption{}, fmt.Errorf("failed to read lockout exemption id for device %s: %v", deviceIP, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return LockoutExemption{}, fmt.Errorf("failed to commit lockout exemption for device %s: %v", deviceIP, err)
+	}
+
+	device.ExemptUntil = exemption.ExpiresAt
+	log.Printf("Lockout exemption granted for %s by %s until %s: %s",
+		deviceIP, exemption.GrantedBy, exemption.ExpiresAt.Format(time.DateTime), exemption.Reason)
+
+	return exemption, nil
+}
+
+// RevokeExemption withdraws the active exemption of a device before it expires
+func (p *PlutoServer) RevokeExemption(deviceIP string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, exists := p.Devices[deviceIP]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceIP)
+	}
+
+	now := time.Now()
+	if !device.exempt(now) {
+		return fmt.Errorf("%w: %s", ErrNoActiveExemption, deviceIP)
+	}
+
+	if err := revokeExemptions(p.Db, deviceIP, now); err != nil {
+		return err
+	}
+
+	device.ExemptUntil = time.Time{}
+	log.Printf("Lockout exemption revoked for %s", deviceIP)
+	return nil
+}
+
+func revokeExemptions(db execer, deviceIP string, at time.Time) error {
+	_, err := db.Exec("UPDATE lockout_exemptions SET revoked_at = ? WHERE device_ip = ? AND revoked_at IS NULL AND expires_at > ?",
+		formatTime(at), deviceIP, formatTime(at))
+	if err != nil {
+		return fmt.Errorf("failed to revoke lockout exemptions for device %s: %v", deviceIP, err)
+	}
+	return nil
+}
+
+// Exemptions returns every exemption granted to a device, oldest first
+func (p *PlutoServer) Exemptions(deviceIP string) ([]LockoutExemption, error) {
+	if _, exists := p.DeviceSnapshot(deviceIP); !exists {
+		return nil, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceIP)
+	}
+
+	rows, err := p.Db.Query("SELECT "+exemptionColumns+" FROM lockout_exemptions WHERE device_ip = ? ORDER BY id", deviceIP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lockout exemptions for device %s: %v", deviceIP, err)
+	}
+	defer rows.Close()
+
+	exemptions := []LockoutExemption{}
+	for rows.Next() {
+		exemption, err := scanExemption(rows)
+		if err != nil {
+			return nil, err
+		}
+		exemptions = append(exemptions, exemption)
+	}
+
+	return exemptions, rows.Err()
+}
+
+func scanExemption(row rowScanner) (LockoutExemption, error) {
+	var exemption LockoutExemption
+	var grantedAt, expiresAt string
+	var revokedAt sql.NullString
+
+	err := row.Scan(&exemption.ID, &exemption.DeviceIP, &exemption.GrantedBy, &exemption.Reason,
+		&grantedAt, &expiresAt, &revokedAt)
+	if err != nil {
+		return LockoutExemption{}, fmt.Errorf("failed to scan lockout exemption: %v", err)
+	}
+
+	exemption.GrantedAt = parseTime(grantedAt)
+	exemption.ExpiresAt = parseTime(expiresAt)
+	if revokedAt.Valid {
+		revoked := parseTime(revokedAt.String)
+		exemption.RevokedAt = &revoked
+	}
+	return exemption, nil
+}
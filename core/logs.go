@@ -0,0 +1,117 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLogPageSize = 100
+	MaxLogPageSize     = 1000
+)
+
+// LogEntry is a row of the logs table
+type LogEntry struct {
+	ID         int64     `json:"id"`
+	DeviceIP   string    `json:"device_ip"`
+	Action     string    `json:"action"`
+	CountValue int       `json:"count_value"`
+	Timestamp  time.Time `json:"timestamp"`
+	Response   int       `json:"response"`
+}
+
+// LogQuery filters the logs table. Zero values match everything. Action matches exactly or as a prefix of
+// "<action>+<n>", so "increment" selects every increment.
+type LogQuery struct {
+	DeviceIP string
+	Action   string
+	From     time.Time // Inclusive
+	To       time.Time // Exclusive
+	Response *int
+	Cursor   int64 // Only entries older than this id, 0 starts with the newest entry
+	Limit    int   // Page size, DefaultLogPageSize when 0
+}
+
+// LogPage is one page of log entries, newest first
+type LogPage struct {
+	Entries    []LogEntry `json:"entries"`
+	NextCursor int64      `json:"next_cursor"` // Cursor of the next page, 0 when this is the last page
+}
+
+// likeEscaper escapes the LIKE wildcards of a value matched with ESCAPE '\', so it only matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// logColumns reads the timestamp as text, the driver cannot parse its layout
+const logColumns = "id, device_ip, action, count_value, CAST(timestamp AS TEXT), response"
+
+func scanLogEntry(row rowScanner) (LogEntry, error) {
+	var entry LogEntry
+	var timestamp string
+
+	err := row.Scan(&entry.ID, &entry.DeviceIP, &entry.Action, &entry.CountValue, &timestamp, &entry.Response)
+	if err != nil {
+		return LogEntry{}, fmt.Errorf("failed to scan log entry: %v", err)
+	}
+
+	entry.Timestamp = parseTime(timestamp)
+	return entry, nil
+}
+
+// QueryLogs returns a page of log entries matching the query, newest first
+func (p *PlutoServer) QueryLogs(q LogQuery) (LogPage, error) {
+	if q.Limit == 0 {
+		q.Limit = DefaultLogPageSize
+	}
+	if q.Limit < 0 || q.Limit > MaxLogPageSize {
+		return LogPage{}, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidInput, MaxLogPageSize)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return LogPage{}, fmt.Errorf("%w: from must be before to", ErrInvalidInput)
+	}
+
+	// Ids provide the order, the time bounds compare the indexed sortable form of the timestamp
+	timeFilter, args := logTimeFilter(q.From, q.To)
+	query := "SELECT " + logColumns + " FROM logs WHERE 1 = 1" + timeFilter
+
+	if q.DeviceIP != "" {
+		query += " AND device_ip = ?"
+		args = append(args, q.DeviceIP)
+	}
+	if q.Action != "" {
+		query += ` AND (action = ? OR action LIKE ? ESCAPE '\')`
+		args = append(args, q.Action, likeEscaper.Replace(q.Action)+"+%")
+	}
+	if q.Response != nil {
+		query += " AND response = ?"
+		args = append(args, *q.Response)
+	}
+	if q.Cursor > 0 {
+		query += " AND id < ?"
+		args = append(args, q.Cursor)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, q.Limit+1) // One more to tell whether there is a next page
+
+	rows, err := p.Db.Query(query, args...)
+	if err != nil {
+		return LogPage{}, fmt.Errorf("failed to query logs: %v", err)
+	}
+	defer rows.Close()
+
+	page := LogPage{Entries: []LogEntry{}}
+	for rows.Next() {
+		entry, err := scanLogEntry(rows)
+		if err != nil {
+			return LogPage{}, err
+		}
+
+		if len(page.Entries) == q.Limit {
+			page.NextCursor = page.Entries[len(page.Entries)-1].ID
+			break
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+
+	return page, rows.Err()
+}
@@ -0,0 +1,199 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDeviceNotFound = errors.New("device not found")
+	ErrInvalidInput   = errors.New("invalid input")
+)
+
+// Kinds of work that can be recorded for a maintenance operation
+const (
+	MaintenanceKindRoutine     = "routine"
+	MaintenanceKindRepair      = "repair"
+	MaintenanceKindReplacement = "replacement"
+	MaintenanceKindInspection  = "inspection"
+)
+
+func validMaintenanceKind(kind string) bool {
+	switch kind {
+	case MaintenanceKindRoutine, MaintenanceKindRepair, MaintenanceKindReplacement, MaintenanceKindInspection:
+		return true
+	}
+	return false
+}
+
+// normalizeMaintenanceRecord validates the caller supplied fields of a maintenance record and applies defaults
+func normalizeMaintenanceRecord(record *MaintenanceRecord) error {
+	record.Technician = strings.TrimSpace(record.Technician)
+	if record.Technician == "" {
+		return fmt.Errorf("%w: technician is required", ErrInvalidInput)
+	}
+	if record.Kind == "" {
+		record.Kind = MaintenanceKindRoutine
+	}
+	if !validMaintenanceKind(record.Kind) {
+		return fmt.Errorf("%w: unknown maintenance kind %q", ErrInvalidInput, record.Kind)
+	}
+	return nil
+}
+
+// RecordMaintenance closes out a maintenance operation for a device. CurrentCount is reset to zero in SQLite and in
+// memory as a single step, TotalCount is left untouched, the operation is added to the maintenance history and a
+// "maintenance" row holding the count at reset is logged. Technician is required, Kind defaults to routine.
+// Any work order still active for the device is completed by the same operation.
+// The returned value is a snapshot of the device after the reset.
+func (p *PlutoServer) RecordMaintenance(deviceIP string, record MaintenanceRecord) (Device, error) {
+	if err := normalizeMaintenanceRecord(&record); err != nil {
+		return Device{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, exists := p.Devices[deviceIP]
+	if !exists {
+		return Device{}, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceIP)
+	}
+
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return Device{}, fmt.Errorf("failed to begin maintenance transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := resetDevice(tx, device, &record); err != nil {
+		return Device{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Device{}, fmt.Errorf("failed to commit maintenance for device %s: %v", deviceIP, err)
+	}
+
+	applyReset(device, record)
+	log.Printf("Maintenance recorded for %s by %s (%s): current count %d -> 0 (total: %d)",
+		deviceIP, record.Technician, record.Kind, record.CountAtReset, device.TotalCount)
+
+	return *device, nil
+}
+
+// resetDevice writes everything a maintenance operation changes in the database within tx. The caller applies the
+// reset to the in-memory device with applyReset once tx is committed.
+func resetDevice(tx *sql.Tx, device *Device, record *MaintenanceRecord) error {
+	record.DeviceIP = device.IP
+	record.PerformedAt = time.Now()
+	record.CountAtReset = device.CurrentCount
+
+	_, err := tx.Exec("UPDATE devices SET current_count = 0, last_maintenance = ? WHERE ip = ?",
+		formatTime(record.PerformedAt), device.IP)
+	if err != nil {
+		return fmt.Errorf("failed to reset count for device %s: %v", device.IP, err)
+	}
+
+	query := `
+	INSERT INTO maintenance_records (device_ip, performed_at, count_at_reset, technician, kind, notes)
+	VALUES (?, ?, ?, ?, ?, ?)`
+
+	result, err := tx.Exec(query, record.DeviceIP, formatTime(record.PerformedAt), record.CountAtReset,
+		record.Technician, record.Kind, record.Notes)
+	if err != nil {
+		return fmt.Errorf("failed to save maintenance record for device %s: %v", device.IP, err)
+	}
+	if record.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to read maintenance record id for device %s: %v", device.IP, err)
+	}
+
+	query = `
+	UPDATE work_orders SET status = ?, maintenance_id = ?, updated_at = ?
+	WHERE device_ip = ? AND status != ?`
+
+	_, err = tx.Exec(query, WorkOrderCompleted, record.ID, formatTime(record.PerformedAt), device.IP, WorkOrderCompleted)
+	if err != nil {
+		return fmt.Errorf("failed to complete work orders for device %s: %v", device.IP, err)
+	}
+
+	if err := endDeferrals(tx, device.IP, DeferralEndMaintenance, record.PerformedAt); err != nil {
+		return err
+	}
+
+	return saveLog(tx, device.IP, "maintenance", record.CountAtReset, int(StartupResponseNormal))
+}
+
+func applyReset(device *Device, record MaintenanceRecord) {
+	device.CurrentCount = 0
+	device.LastMaintenance = record.PerformedAt
+	device.Deferral = nil
+}
+
+// MaintenanceTimeline is the service history of a device since it was registered
+type MaintenanceTimeline struct {
+	IP           string              `json:"ip"`
+	RegisteredAt time.Time           `json:"registered_at"`
+	CurrentCount int                 `json:"current_count"`
+	TotalCount   int                 `json:"total_count"`
+	Records      []MaintenanceRecord `json:"records"`
+}
+
+// DeviceTimeline combines the registration data of a device with its maintenance history
+func (p *PlutoServer) DeviceTimeline(deviceIP string) (MaintenanceTimeline, error) {
+	device, exists := p.DeviceSnapshot(deviceIP)
+	if !exists {
+		return MaintenanceTimeline{}, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceIP)
+	}
+
+	records, err := p.MaintenanceHistory(deviceIP)
+	if err != nil {
+		return MaintenanceTimeline{}, err
+	}
+
+	return MaintenanceTimeline{
+		IP:           device.IP,
+		RegisteredAt: device.RegisteredAt,
+		CurrentCount: device.CurrentCount,
+		TotalCount:   device.TotalCount,
+		Records:      records,
+	}, nil
+}
+
+// MaintenanceHistory returns every maintenance operation recorded for a device, oldest first
+func (p *PlutoServer) MaintenanceHistory(deviceIP string) ([]MaintenanceRecord, error) {
+	rows, err := p.Db.Query("SELECT "+maintenanceColumns+" FROM maintenance_records WHERE device_ip = ? ORDER BY id", deviceIP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load maintenance history for device %s: %v", deviceIP, err)
+	}
+	defer rows.Close()
+
+	records := []MaintenanceRecord{}
+	for rows.Next() {
+		record, err := scanMaintenanceRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+const maintenanceColumns = "id, device_ip, performed_at, count_at_reset, technician, kind, notes"
+
+func scanMaintenanceRecord(row rowScanner) (MaintenanceRecord, error) {
+	var record MaintenanceRecord
+	var performedAt string
+
+	err := row.Scan(&record.ID, &record.DeviceIP, &performedAt, &record.CountAtReset,
+		&record.Technician, &record.Kind, &record.Notes)
+	if err != nil {
+		return MaintenanceRecord{}, fmt.Errorf("failed to scan maintenance record: %v", err)
+	}
+
+	record.PerformedAt = parseTime(performedAt)
+	return record, nil
+}
@@ -3,22 +3,105 @@ package core
 import (
 	"database/sql"
 	"net"
+	"os"
+	"sync"
 	"time"
 )
 
-const PlutoDBPassword = "a_very_secret_pluto_password_!@#"
-
 type Device struct {
-	IP           string    // IP address of a device
-	CurrentCount int       // Total trigger count after a maintenance operation
-	TotalCount   int       // Total trigger count after service deployment (doesn't reset after maintenance)
-	LastSeen     time.Time // The last timestamp for a device be seen as online
-	RegisteredAt time.Time // First registration timestamp of a device to this service
+	IP           string    `json:"ip"`            // IP address of a device
+	Serial       string    `json:"serial"`        // Manufacturer serial number, empty for auto-registered devices
+	CurrentCount int       `json:"current_count"` // Total trigger count after a maintenance operation
+	TotalCount   int       `json:"total_count"`   // Total trigger count after service deployment (doesn't reset after maintenance)
+	LastSeen     time.Time `json:"last_seen"`     // The last timestamp for a device be seen as online
+	RegisteredAt time.Time `json:"registered_at"` // First registration timestamp of a device to this service
+	Threshold    int       `json:"threshold"`     // Device specific maintenance threshold, 0 falls back to the model or PlutoServer.Threshold
+	Model        string    `json:"model"`         // Name of the DeviceModel the unit belongs to, empty when unassigned
+	Site         string    `json:"site"`          // Site the unit is installed at, technicians only service the units of their sites
+
+	LastMaintenance time.Time `json:"last_maintenance"` // Timestamp of the latest maintenance operation, zero if never serviced
+	ExemptUntil     time.Time `json:"exempt_until"`     // Expiry of the active lockout exemption, zero if none
+
+	Deferral *MaintenanceDeferral `json:"deferral"` // Deferral that has not ended yet, nil if none
+
+	DecommissionedAt time.Time `json:"decommissioned_at"` // When the unit was retired from service, zero while in service
+}
+
+// MaintenanceDeferral postpones the maintenance replies of a device until a date or an extra trigger budget is used up
+type MaintenanceDeferral struct {
+	ID              int64      `json:"id"`
+	DeviceIP        string     `json:"device_ip"`
+	DeferredBy      string     `json:"deferred_by"` // Supervisor who approved the deferral
+	Reason          string     `json:"reason"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Until           *time.Time `json:"until"`             // Date the deferral ends, nil for a trigger budget only
+	ExtraTriggers   int        `json:"extra_triggers"`    // Triggers allowed past CountAtDeferral, 0 for a date only
+	CountAtDeferral int        `json:"count_at_deferral"` // CurrentCount of the device when the deferral was granted
+	EndedAt         *time.Time `json:"ended_at"`          // Set once the deferral expired, was cancelled or replaced
+	EndReason       string     `json:"end_reason"`        // One of the DeferralEnd values
+}
+
+// LockoutExemption lets a device keep operating past the lockout margin until it expires or is revoked
+type LockoutExemption struct {
+	ID        int64      `json:"id"`
+	DeviceIP  string     `json:"device_ip"`
+	GrantedBy string     `json:"granted_by"`
+	Reason    string     `json:"reason"`
+	GrantedAt time.Time  `json:"granted_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"` // Set when the exemption was withdrawn before it expired
+}
+
+// DeviceModel is a laser unit hardware generation with its own maintenance policy
+type DeviceModel struct {
+	Name           string `json:"name"`
+	Threshold      int    `json:"threshold"`       // Maintenance threshold of units of this model
+	WarningPercent int    `json:"warning_percent"` // Overrides PlutoServer.WarningPercent when set
+	LifetimeLimit  int    `json:"lifetime_limit"`  // TotalCount after which a unit should be retired, 0 means unlimited
+	IntervalDays   int    `json:"interval_days"`   // Overrides PlutoServer.IntervalDays when set
+}
+
+type MaintenanceRecord struct {
+	ID           int64     `json:"id"`
+	DeviceIP     string    `json:"device_ip"`
+	PerformedAt  time.Time `json:"performed_at"`   // When the maintenance operation was recorded
+	CountAtReset int       `json:"count_at_reset"` // CurrentCount of the device right before it was reset
+	Technician   string    `json:"technician"`     // Person who performed the maintenance
+	Kind         string    `json:"kind"`           // Kind of work, one of the MaintenanceKind values
+	Notes        string    `json:"notes"`
+}
+
+type WorkOrder struct {
+	ID            int64     `json:"id"`
+	DeviceIP      string    `json:"device_ip"`
+	Status        string    `json:"status"`         // One of the WorkOrder status values, moves open -> assigned -> in_progress -> completed
+	Reason        string    `json:"reason"`         // What opened the order, WorkOrderReasonThreshold or WorkOrderReasonCalendar
+	CountAtOpen   int       `json:"count_at_open"`  // CurrentCount of the device when the threshold was crossed
+	Assignee      string    `json:"assignee"`       // Technician responsible for the order
+	OpenedAt      time.Time `json:"opened_at"`      // When the threshold crossing opened the order
+	UpdatedAt     time.Time `json:"updated_at"`     // Last status change
+	MaintenanceID int64     `json:"maintenance_id"` // Maintenance record that completed the order, 0 while active
 }
 
 type PlutoServer struct {
-	Db        *sql.DB
-	Devices   map[string]*Device
-	Conn      *net.UDPConn
-	Threshold int // After the trigger count of a device exceeds a certain Threshold value, it must go to maintenance
+	Db             *sql.DB
+	DBKey          string // Encryption key of the database, required by InitDB
+	Devices        map[string]*Device
+	Models         map[string]*DeviceModel
+	Conn           *net.UDPConn
+	Threshold      int // After the trigger count of a device exceeds a certain Threshold value, it must go to maintenance
+	WarningPercent int // Percentage of Threshold at which a device is reported as approaching maintenance, 0 disables
+	GraceMargin    int // Triggers past Threshold after which a device is reported as overdue, 0 disables
+	IntervalDays   int // Days after the last maintenance (or registration) at which a device is due regardless of its count, 0 disables
+	LockoutMargin  int // Triggers past Threshold after which a device is told to refuse operation, 0 disables
+
+	TLS TLSOptions // HTTPS settings of the HTTP server
+
+	mu         sync.Mutex   // Guards Devices and Models against concurrent UDP and HTTP handlers
+	events     eventHub     // Live event subscribers
+	dbName     string       // Database file opened by InitDB
+	dbFile     os.FileInfo  // File behind dbName when it was opened, replaced by Rekey
+	connector  *dbConnector // Opens the connections of Db, switched to the new key by Rekey
+	writes     sync.RWMutex // Held for reading by database writes outside mu, and exclusively by Rekey
+	configured int          // Threshold before a stored one replaced it, restored by ClearThreshold
 }
@@ -0,0 +1,17 @@
+package core
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPISpec is the OpenAPI document of the HTTP API. It is maintained by hand together with HTTPHandler and the
+// client package, update all three when a route changes.
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
+
+func (p *PlutoServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(OpenAPISpec)
+}
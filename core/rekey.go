@@ -0,0 +1,424 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	sqlite3 "github.com/mutecomm/go-sqlcipher/v4"
+)
+
+// ErrDBReplaced is returned by writes that landed in a database file replaced by a concurrent rekey
+var ErrDBReplaced = errors.New("database replaced by a key rotation")
+
+// Files next to the database while its key is rotated
+const (
+	rekeyCopySuffix   = ".rekey" // Copy encrypted with the new key, until it replaces the database
+	rekeyBackupSuffix = ".old"   // Original encrypted with the old key, removed once the copy replaced it
+)
+
+// RekeyResult reports a completed key rotation
+type RekeyResult struct {
+	Tables int    `json:"tables"` // Tables copied to the database with the new key
+	Rows   int    `json:"rows"`   // Rows copied over all tables
+	Backup string `json:"backup"` // Original database under the old key, empty unless it was kept
+}
+
+// RekeyDatabase re-encrypts the database of a stopped server from the old key to the new one. The rows are copied to
+// a new file that is verified with the new key before it replaces the database, and the original is only removed once
+// the swap succeeded. With keepBackup the original stays next to the database with a .old suffix. A database that is
+// not encrypted yet, as written by earlier versions, is encrypted with the new key and needs no old key. ErrDBInUse is
+// returned while a server holds the database, see HoldDatabase.
+func RekeyDatabase(dbName, oldKey, newKey string, keepBackup bool) (RekeyResult, error) {
+	// InitDB would create an empty database under a mistyped name
+	if _, err := os.Stat(dbName); err != nil {
+		return RekeyResult{}, fmt.Errorf("failed to read database: %v", err)
+	}
+	release, err := lockDatabase(dbName, true)
+	if err != nil {
+		return RekeyResult{}, err
+	}
+	defer release()
+
+	plaintext, err := IsPlaintextDB(dbName)
+	if err != nil {
+		return RekeyResult{}, err
+	}
+
+	server := &PlutoServer{DBKey: oldKey}
+	if plaintext {
+		log.Printf("Database %s is not encrypted yet, encrypting it with the new key", dbName)
+		server.DBKey = ""
+		err = server.initDB(dbName)
+	} else {
+		err = server.InitDB(dbName)
+	}
+	if err != nil {
+		return RekeyResult{}, fmt.Errorf("failed to open database with the old key: %w", err)
+	}
+	defer server.Db.Close()
+
+	return server.rekey(newKey, keepBackup)
+}
+
+// Rekey re-encrypts the database of a running server with a new key, see RekeyDatabase. Device state is locked while
+// the database is copied and swapped, so UDP events wait in the receive queue and are handled against the new file.
+// The key source of the server must be updated before its next start.
+func (p *PlutoServer) Rekey(newKey string, keepBackup bool) (RekeyResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.rekey(newKey, keepBackup)
+}
+
+func (p *PlutoServer) rekey(newKey string, keepBackup bool) (RekeyResult, error) {
+	switch {
+	case newKey == "":
+		return RekeyResult{}, fmt.Errorf("%w: a new key is required", ErrInvalidInput)
+	case newKey == p.DBKey:
+		return RekeyResult{}, fmt.Errorf("%w: the new key must differ from the current key", ErrInvalidInput)
+	case p.connector == nil:
+		return RekeyResult{}, errors.New("the database was not opened by InitDB")
+	}
+
+	// Writes outside p.mu wait in-process, other processes are held off by the write lock of the snapshot
+	p.writes.Lock()
+	defer p.writes.Unlock()
+
+	srcTx, err := p.Db.Begin()
+	if err != nil {
+		return RekeyResult{}, fmt.Errorf("failed to read database: %v", err)
+	}
+	defer srcTx.Rollback()
+	// An empty write takes the write lock until the swap is done, so no row lands in the original after the copy
+	if _, err := srcTx.Exec("DELETE FROM settings WHERE 0"); err != nil {
+		return RekeyResult{}, fmt.Errorf("failed to lock database: %v", err)
+	}
+
+	copyPath := p.dbName + rekeyCopySuffix
+	result, err := copyDatabase(srcTx, copyPath, newKey)
+	if err != nil {
+		os.Remove(copyPath)
+		return RekeyResult{}, err
+	}
+
+	backup := p.dbName + rekeyBackupSuffix
+	err = p.connector.switchKey(dbDSN(p.dbName, newKey), func() error {
+		return swapDatabase(p.dbName, copyPath, backup)
+	})
+	if err != nil {
+		return RekeyResult{}, err
+	}
+	p.DBKey = newKey
+	if p.dbFile, err = os.Stat(p.dbName); err != nil {
+		return RekeyResult{}, fmt.Errorf("failed to read database: %v", err)
+	}
+	srcTx.Rollback()
+
+	if keepBackup {
+		result.Backup = backup
+	} else if err := os.Remove(backup); err != nil {
+		log.Printf("Failed to remove %s, it is still encrypted with the old key: %v", backup, err)
+		result.Backup = backup
+	}
+
+	log.Printf("Database %s re-encrypted with a new key (%d tables, %d rows)", p.dbName, result.Tables, result.Rows)
+	return result, nil
+}
+
+// copyDatabase copies every row visible to the transaction srcTx into a new database at path encrypted with key, and
+// checks the copy through a fresh connection with that key
+func copyDatabase(srcTx *sql.Tx, path, key string) (RekeyResult, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return RekeyResult{}, fmt.Errorf("failed to remove the copy of an earlier attempt: %v", err)
+	}
+
+	// The copy gets the current schema first, src was migrated to it by InitDB
+	dst := &PlutoServer{DBKey: key}
+	if err := dst.InitDB(path); err != nil {
+		return RekeyResult{}, fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	defer dst.Db.Close()
+
+	tables, err := tableNames(srcTx)
+	if err != nil {
+		return RekeyResult{}, err
+	}
+
+	dstTx, err := dst.Db.Begin()
+	if err != nil {
+		return RekeyResult{}, fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	defer dstTx.Rollback()
+
+	result := RekeyResult{Tables: len(tables)}
+	counts := make(map[string]int, len(tables))
+	for _, table := range tables {
+		n, err := copyTable(srcTx, dstTx, table)
+		if err != nil {
+			return RekeyResult{}, err
+		}
+		counts[table] = n
+		result.Rows += n
+	}
+	if err := copySequences(srcTx, dstTx); err != nil {
+		return RekeyResult{}, err
+	}
+
+	if err := dstTx.Commit(); err != nil {
+		return RekeyResult{}, fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := verifyCopy(path, key, counts); err != nil {
+		return RekeyResult{}, err
+	}
+	return result, nil
+}
+
+// tableNames returns the tables of a database, without the internal tables of SQLite
+func tableNames(tx *sql.Tx) ([]string, error) {
+	rows, err := tx.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %v", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to list tables: %v", err)
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+func tableColumns(tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.Query("PRAGMA table_info(" + quoteIdent(table) + ")")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, fmt.Errorf("failed to read columns of %s: %v", table, err)
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// copyTable copies the rows of a table and returns their number. Values are read as text so timestamps keep the
+// format they were stored in instead of being parsed by the driver, the column types turn numbers back into integers.
+func copyTable(src, dst *sql.Tx, table string) (int, error) {
+	columns, err := tableColumns(src, table)
+	if err != nil {
+		return 0, err
+	}
+
+	selected := make([]string, len(columns))
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		selected[i] = fmt.Sprintf("CAST(%s AS TEXT)", quoteIdent(column))
+		names[i] = quoteIdent(column)
+	}
+	insert, err := dst.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (?%s)", quoteIdent(table),
+		strings.Join(names, ", "), strings.Repeat(", ?", len(columns)-1)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy %s: %v", table, err)
+	}
+	defer insert.Close()
+
+	rows, err := src.Query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(selected, ", "), quoteIdent(table)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	values := make([]sql.NullString, len(columns))
+	targets := make([]any, len(columns))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+	args := make([]any, len(columns))
+
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(targets...); err != nil {
+			return 0, fmt.Errorf("failed to read %s: %v", table, err)
+		}
+		for i, value := range values {
+			args[i] = nil
+			if value.Valid {
+				args[i] = value.String
+			}
+		}
+		if _, err := insert.Exec(args...); err != nil {
+			return 0, fmt.Errorf("failed to copy %s: %v", table, err)
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read %s: %v", table, err)
+	}
+	return n, nil
+}
+
+// copySequences carries the AUTOINCREMENT counters over, so ids of deleted rows are not handed out again
+func copySequences(src, dst *sql.Tx) error {
+	rows, err := src.Query("SELECT name, seq FROM sqlite_sequence")
+	if err != nil {
+		return fmt.Errorf("failed to read sqlite_sequence: %v", err)
+	}
+	defer rows.Close()
+
+	if _, err := dst.Exec("DELETE FROM sqlite_sequence"); err != nil {
+		return fmt.Errorf("failed to copy sqlite_sequence: %v", err)
+	}
+	for rows.Next() {
+		var name string
+		var seq int64
+		if err := rows.Scan(&name, &seq); err != nil {
+			return fmt.Errorf("failed to read sqlite_sequence: %v", err)
+		}
+		if _, err := dst.Exec("INSERT INTO sqlite_sequence (name, seq) VALUES (?, ?)", name, seq); err != nil {
+			return fmt.Errorf("failed to copy sqlite_sequence: %v", err)
+		}
+	}
+	return rows.Err()
+}
+
+// verifyCopy opens the copy with the new key and checks its integrity and the number of rows of every table
+func verifyCopy(path, key string, counts map[string]int) error {
+	db, err := sql.Open("sqlite3", dbDSN(path, key))
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer db.Close()
+
+	var check string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&check); err != nil {
+		return fmt.Errorf("failed to verify %s with the new key: %v", path, err)
+	}
+	if check != "ok" {
+		return fmt.Errorf("copy %s failed the integrity check: %s", path, check)
+	}
+
+	for table, want := range counts {
+		var got int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + quoteIdent(table)).Scan(&got); err != nil {
+			return fmt.Errorf("failed to verify %s: %v", path, err)
+		}
+		if got != want {
+			return fmt.Errorf("copy %s holds %d rows in %s instead of %d", path, got, table, want)
+		}
+	}
+	return nil
+}
+
+// swapDatabase moves the verified copy in place of the database, keeping the original as backup. The original is
+// put back when the copy cannot be moved.
+func swapDatabase(dbName, copyPath, backup string) error {
+	if err := os.Rename(dbName, backup); err != nil {
+		return fmt.Errorf("failed to move %s aside: %v", dbName, err)
+	}
+	if err := os.Rename(copyPath, dbName); err != nil {
+		if restoreErr := os.Rename(backup, dbName); restoreErr != nil {
+			return fmt.Errorf("failed to move %s in place (%v) and to restore the original from %s: %v", copyPath, err,
+				backup, restoreErr)
+		}
+		return fmt.Errorf("failed to move %s in place, the original was restored: %v", copyPath, err)
+	}
+	return nil
+}
+
+// checkDBFile returns an error when the database file was replaced since it was opened, by the rekey of another
+// process. Writes made until then landed in the replaced file and are lost.
+func (p *PlutoServer) checkDBFile() error {
+	if p.dbFile == nil {
+		return nil
+	}
+	info, err := os.Stat(p.dbName)
+	if err != nil || !os.SameFile(info, p.dbFile) {
+		return fmt.Errorf("%w: %s was re-encrypted during the change, repeat it with the new key", ErrDBReplaced, p.dbName)
+	}
+	return nil
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// dbConnector opens the connections of PlutoServer.Db with the current key. Rekey switches it to the new file and key,
+// connections opened before are closed by the pool instead of being reused, as they still point at the old file.
+type dbConnector struct {
+	mu         sync.Mutex
+	dsn        string
+	generation int
+}
+
+func (c *dbConnector) Connect(context.Context) (driver.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &keyedConn{SQLiteConn: conn.(*sqlite3.SQLiteConn), connector: c, generation: c.generation}, nil
+}
+
+func (c *dbConnector) Driver() driver.Driver {
+	return &sqlite3.SQLiteDriver{}
+}
+
+// switchKey runs swap while no connection can be opened, and moves to the new data source name once it succeeded
+func (c *dbConnector) switchKey(dsn string, swap func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := swap(); err != nil {
+		return err
+	}
+	c.dsn = dsn
+	c.generation++
+	return nil
+}
+
+func (c *dbConnector) current(generation int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return generation == c.generation
+}
+
+// keyedConn is a connection opened by a dbConnector, it reports itself invalid once the key was switched
+type keyedConn struct {
+	*sqlite3.SQLiteConn
+	connector  *dbConnector
+	generation int
+}
+
+// IsValid implements driver.Validator, the pool closes invalid connections when they are returned
+func (c *keyedConn) IsValid() bool {
+	return c.connector.current(c.generation)
+}
+
+// ResetSession implements driver.SessionResetter, so idle connections of an old key are not handed out again
+func (c *keyedConn) ResetSession(context.Context) error {
+	if !c.IsValid() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
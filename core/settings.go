@@ -0,0 +1,141 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// settingThreshold is the settings row holding PlutoServer.Threshold once it was changed at runtime
+const settingThreshold = "threshold"
+
+// Settings is the server wide maintenance policy
+type Settings struct {
+	Threshold      int `json:"threshold"`
+	WarningPercent int `json:"warning_percent"`
+	GraceMargin    int `json:"grace_margin"`
+	LockoutMargin  int `json:"lockout_margin"`
+	IntervalDays   int `json:"interval_days"`
+}
+
+// ThresholdChange reports a runtime update of the global threshold
+type ThresholdChange struct {
+	Previous  int      `json:"previous"`
+	Threshold int      `json:"threshold"`
+	NewlyDue  []string `json:"newly_due"` // Devices that became due under the new threshold and got a work order, sorted
+}
+
+// Settings returns the server wide maintenance policy in effect
+func (p *PlutoServer) Settings() Settings {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return Settings{
+		Threshold:      p.Threshold,
+		WarningPercent: p.WarningPercent,
+		GraceMargin:    p.GraceMargin,
+		LockoutMargin:  p.LockoutMargin,
+		IntervalDays:   p.IntervalDays,
+	}
+}
+
+// LoadSettings applies the threshold stored by SetThreshold, replacing the configured value until ClearThreshold. It is
+// a no-op until the threshold was changed at runtime.
+func (p *PlutoServer) LoadSettings() error {
+	var value string
+	err := p.Db.QueryRow("SELECT value FROM settings WHERE name = ?", settingThreshold).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %v", err)
+	}
+
+	threshold, err := strconv.Atoi(value)
+	if err != nil || threshold <= 0 {
+		return fmt.Errorf("invalid stored threshold %q", value)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if threshold != p.Threshold {
+		log.Printf("Using the stored maintenance threshold %d instead of %d, clear it with DELETE /api/v1/settings/threshold",
+			threshold, p.Threshold)
+	}
+	p.keepConfigured()
+	p.Threshold = threshold
+	return nil
+}
+
+// keepConfigured remembers the configured threshold before a stored one first replaces it, the caller holds p.mu
+func (p *PlutoServer) keepConfigured() {
+	if p.configured == 0 {
+		p.configured = p.Threshold
+	}
+}
+
+// SetThreshold changes the global maintenance threshold without a restart and stores it so it survives one. Devices
+// that are due under the new threshold get a work order like a regular threshold crossing.
+func (p *PlutoServer) SetThreshold(threshold int) (ThresholdChange, error) {
+	if threshold <= 0 {
+		return ThresholdChange{}, fmt.Errorf("%w: threshold must be positive", ErrInvalidInput)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	query := `
+	INSERT OR REPLACE INTO settings (name, value, updated_at)
+	VALUES (?, ?, ?)`
+
+	if _, err := p.Db.Exec(query, settingThreshold, strconv.Itoa(threshold), formatTime(time.Now())); err != nil {
+		return ThresholdChange{}, fmt.Errorf("failed to save threshold: %v", err)
+	}
+
+	p.keepConfigured()
+	return p.applyThreshold(threshold), nil
+}
+
+// ClearThreshold deletes the threshold stored by SetThreshold and returns to the configured one, the
+// maintenance-threshold flag of the server. Devices that are due under it get a work order like on SetThreshold.
+func (p *PlutoServer) ClearThreshold() (ThresholdChange, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.Db.Exec("DELETE FROM settings WHERE name = ?", settingThreshold); err != nil {
+		return ThresholdChange{}, fmt.Errorf("failed to clear threshold: %v", err)
+	}
+
+	threshold := p.Threshold
+	if p.configured != 0 {
+		threshold, p.configured = p.configured, 0
+	}
+	return p.applyThreshold(threshold), nil
+}
+
+// applyThreshold switches to a new global threshold and opens work orders for the devices due under it, the caller
+// holds p.mu
+func (p *PlutoServer) applyThreshold(threshold int) ThresholdChange {
+	oldLevels := make(map[*Device]MaintenanceLevel)
+	for _, device := range p.Devices {
+		oldLevels[device] = p.levelAt(device, device.CurrentCount)
+	}
+
+	change := ThresholdChange{Previous: p.Threshold, Threshold: threshold, NewlyDue: []string{}}
+	p.Threshold = threshold
+	log.Printf("Maintenance threshold changed from %d to %d", change.Previous, threshold)
+
+	for device, oldLevel := range oldLevels {
+		if p.checkCrossing(device, oldLevel) {
+			change.NewlyDue = append(change.NewlyDue, device.IP)
+		}
+	}
+	sort.Strings(change.NewlyDue)
+
+	return change
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// DeviceStatus is a device together with the maintenance figures computed from its policy
+type DeviceStatus struct {
+	Device
+	EffectiveThreshold int              `json:"effective_threshold"`   // Threshold after resolving the override, model and server settings
+	Status             MaintenanceLevel `json:"status"`                // Current maintenance level
+	PercentUsed        float64          `json:"percent_used"`          // CurrentCount as a percentage of EffectiveThreshold
+	LastSeenAgeSeconds int64            `json:"last_seen_age_seconds"` // Seconds since the device was last seen
+	DueDate            *time.Time       `json:"due_date"`              // End of the calendar interval, null when no interval applies
+	LifetimeExceeded   bool             `json:"lifetime_exceeded"`     // TotalCount reached the lifetime limit of the model
+}
+
+// statusOf computes the status of a device. The caller holds p.mu.
+func (p *PlutoServer) statusOf(device *Device, now time.Time) DeviceStatus {
+	status := DeviceStatus{
+		Device:             *device,
+		EffectiveThreshold: p.thresholdFor(device),
+		Status:             p.levelAt(device, device.CurrentCount),
+		LastSeenAgeSeconds: int64(now.Sub(device.LastSeen).Seconds()),
+		LifetimeExceeded:   p.lifetimeExceeded(device),
+	}
+
+	if status.EffectiveThreshold > 0 {
+		percent := float64(device.CurrentCount) * 100 / float64(status.EffectiveThreshold)
+		status.PercentUsed = math.Round(percent*10) / 10
+	}
+	if due := p.dueDate(device); !due.IsZero() {
+		status.DueDate = &due
+	}
+
+	return status
+}
+
+// DeviceStatuses returns the status of every device sorted by IP
+func (p *PlutoServer) DeviceStatuses() []DeviceStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]DeviceStatus, 0, len(p.Devices))
+	for _, device := range p.Devices {
+		statuses = append(statuses, p.statusOf(device, now))
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].IP < statuses[j].IP })
+	return statuses
+}
+
+// DeviceStatusOf returns the status of a single device
+func (p *PlutoServer) DeviceStatusOf(deviceIP string) (DeviceStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	device, exists := p.Devices[deviceIP]
+	if !exists {
+		return DeviceStatus{}, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceIP)
+	}
+	return p.statusOf(device, time.Now()), nil
+}
@@ -0,0 +1,205 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Client certificate modes of the HTTP server
+const (
+	ClientAuthOptional = "optional" // Certificates are verified when presented, clients without one rely on their token
+	ClientAuthRequire  = "require"  // Every client must present a certificate signed by the client CA
+)
+
+// Files written for a self-signed certificate when no paths are configured
+const (
+	SelfSignedCertFile = "pluto-cert.pem"
+	SelfSignedKeyFile  = "pluto-key.pem"
+)
+
+// TLSOptions configures HTTPS for the HTTP server, which serves plain HTTP when CertFile, KeyFile and SelfSigned are
+// all unset
+type TLSOptions struct {
+	CertFile     string // PEM certificate chain, reloaded when the file changes
+	KeyFile      string // PEM private key of the certificate
+	SelfSigned   bool   // Generate CertFile and KeyFile when they do not exist, for lab installs
+	ClientCAFile string // PEM certificates of the CAs that sign client certificates, empty disables mTLS
+	ClientAuth   string // ClientAuthRequire (default) or ClientAuthOptional, needs ClientCAFile
+}
+
+func (o TLSOptions) enabled() bool {
+	return o.CertFile != "" || o.KeyFile != "" || o.SelfSigned
+}
+
+// TLSConfig returns the TLS configuration of the HTTP server, nil when TLS is disabled. A self-signed certificate is
+// generated first when one is requested and missing. Client certificate options without TLS are an error, the server
+// would otherwise serve plain HTTP to clients expected to authenticate with a certificate.
+func (p *PlutoServer) TLSConfig() (*tls.Config, error) {
+	options := p.TLS
+	if options.ClientAuth != "" && options.ClientCAFile == "" {
+		return nil, errors.New("client certificate verification needs a client CA file")
+	}
+	if !options.enabled() {
+		if options.ClientCAFile != "" {
+			return nil, errors.New("client certificate verification needs TLS, configure a certificate or a self-signed one")
+		}
+		return nil, nil
+	}
+
+	if options.SelfSigned {
+		if options.CertFile == "" && options.KeyFile == "" {
+			options.CertFile, options.KeyFile = SelfSignedCertFile, SelfSignedKeyFile
+		}
+		if err := ensureSelfSigned(options.CertFile, options.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if options.CertFile == "" || options.KeyFile == "" {
+		return nil, errors.New("TLS needs both a certificate and a key file")
+	}
+
+	reloader := &certReloader{certFile: options.CertFile, keyFile: options.KeyFile}
+	if _, err := reloader.GetCertificate(nil); err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if options.ClientCAFile != "" {
+		data, err := os.ReadFile(options.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %v", err)
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in client CA file %s", options.ClientCAFile)
+		}
+
+		switch options.ClientAuth {
+		case "", ClientAuthRequire:
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		case ClientAuthOptional:
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, fmt.Errorf("unknown client auth mode %q (use require or optional)", options.ClientAuth)
+		}
+	}
+
+	return config, nil
+}
+
+// certReloader serves a certificate from disk and loads it again once either file was modified, so renewed
+// certificates are picked up without a restart
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	certInfo, certErr := os.Stat(c.certFile)
+	keyInfo, keyErr := os.Stat(c.keyFile)
+	if err := errors.Join(certErr, keyErr); err != nil {
+		if c.cert == nil {
+			return nil, fmt.Errorf("failed to read TLS certificate: %v", err)
+		}
+		log.Printf("Keeping the loaded TLS certificate: %v", err)
+		return c.cert, nil
+	}
+
+	if c.cert != nil && certInfo.ModTime().Equal(c.certMod) && keyInfo.ModTime().Equal(c.keyMod) {
+		return c.cert, nil
+	}
+
+	// A pair that is still being written fails to load, the next handshake tries again
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert == nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %v", err)
+		}
+		log.Printf("Keeping the loaded TLS certificate, the changed files failed to load: %v", err)
+		return c.cert, nil
+	}
+
+	if c.cert != nil {
+		log.Printf("Reloaded TLS certificate from %s", c.certFile)
+	}
+	c.cert = &cert
+	c.certMod, c.keyMod = certInfo.ModTime(), keyInfo.ModTime()
+	return c.cert, nil
+}
+
+// ensureSelfSigned writes a self-signed certificate for localhost and this host unless both files already exist
+func ensureSelfSigned(certFile, keyFile string) error {
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if certErr == nil && keyErr == nil {
+		return nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate TLS key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("failed to generate certificate serial: %v", err)
+	}
+
+	hosts := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		hosts = append(hosts, hostname)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hosts[len(hosts)-1], Organization: []string{"Pluto self-signed"}},
+		DNSNames:     hosts,
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create self-signed certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode TLS key: %v", err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("failed to write TLS key: %v", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("failed to write TLS certificate: %v", err)
+	}
+
+	log.Printf("Generated a self-signed TLS certificate for %v in %s, valid until %s", hosts, certFile,
+		template.NotAfter.Format(time.DateOnly))
+	return nil
+}
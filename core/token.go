@@ -0,0 +1,223 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrTokenNotFound = errors.New("API token not found")
+
+// APIToken describes an issued API token, the token itself is only known when it is issued
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`  // Person or tool the token was issued to
+	Role       string     `json:"role"`  // One of the Role values
+	Sites      []string   `json:"sites"` // Sites a technician services, empty for other roles
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+const tokenColumns = "id, name, role, sites, created_at, last_used_at, revoked_at"
+
+// hashToken returns the value stored for a token, tokens are random so a plain SHA-256 suffices
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueToken creates a token for the HTTP API with a role, and the sites the holder services for technicians. It
+// returns the token together with its description. Only the hash of the token is stored, it cannot be shown again.
+// Names identify tokens for revocation, so they must be unique among the tokens that are not revoked.
+func (p *PlutoServer) IssueToken(name, role string, sites []string) (string, APIToken, error) {
+	name = strings.TrimSpace(name)
+	var cleaned []string
+	for _, site := range sites {
+		if site = strings.TrimSpace(site); site != "" && !slices.Contains(cleaned, site) {
+			cleaned = append(cleaned, site)
+		}
+	}
+
+	switch {
+	case name == "":
+		return "", APIToken{}, fmt.Errorf("%w: a token name is required", ErrInvalidInput)
+	case roleRank(role) < 0:
+		return "", APIToken{}, fmt.Errorf("%w: unknown role %q (use viewer, technician or admin)", ErrInvalidInput, role)
+	case role == RoleTechnician && len(cleaned) == 0:
+		return "", APIToken{}, fmt.Errorf("%w: technicians need at least one site", ErrInvalidInput)
+	case role != RoleTechnician && len(cleaned) > 0:
+		return "", APIToken{}, fmt.Errorf("%w: only technicians are limited to sites", ErrInvalidInput)
+	}
+
+	p.writes.RLock()
+	defer p.writes.RUnlock()
+
+	var active int
+	if err := p.Db.QueryRow("SELECT COUNT(*) FROM api_tokens WHERE name = ? AND revoked_at IS NULL", name).Scan(&active); err != nil {
+		return "", APIToken{}, fmt.Errorf("failed to query API tokens: %v", err)
+	}
+	if active > 0 {
+		return "", APIToken{}, fmt.Errorf("%w: a token named %q already exists, revoke it first", ErrInvalidInput, name)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", APIToken{}, fmt.Errorf("failed to generate API token: %v", err)
+	}
+	token := hex.EncodeToString(secret)
+
+	issued := APIToken{Name: name, Role: role, Sites: cleaned, CreatedAt: time.Now()}
+	result, err := p.Db.Exec("INSERT INTO api_tokens (name, role, sites, hash, created_at) VALUES (?, ?, ?, ?, ?)",
+		name, role, strings.Join(cleaned, ","), hashToken(token), formatTime(issued.CreatedAt))
+	if err != nil {
+		if replaced := p.checkDBFile(); replaced != nil {
+			return "", APIToken{}, replaced
+		}
+		return "", APIToken{}, fmt.Errorf("failed to save API token %s: %v", name, err)
+	}
+	if issued.ID, err = result.LastInsertId(); err != nil {
+		return "", APIToken{}, fmt.Errorf("failed to read API token id for %s: %v", name, err)
+	}
+	if err := p.checkDBFile(); err != nil {
+		return "", APIToken{}, err
+	}
+
+	log.Printf("API token issued to %s (role: %s)", name, role)
+	return token, issued, nil
+}
+
+// RevokeToken revokes the active token with the given name, requests carrying it are rejected from then on. A revoke
+// that raced with the rekey of another process is reported as failed, it has to be repeated.
+func (p *PlutoServer) RevokeToken(name string) error {
+	p.writes.RLock()
+	defer p.writes.RUnlock()
+
+	result, err := p.Db.Exec("UPDATE api_tokens SET revoked_at = ? WHERE name = ? AND revoked_at IS NULL",
+		formatTime(time.Now()), name)
+	if err != nil {
+		if replaced := p.checkDBFile(); replaced != nil {
+			return replaced
+		}
+		return fmt.Errorf("failed to revoke API token %s: %v", name, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to revoke API token %s: %v", name, err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrTokenNotFound, name)
+	}
+	if err := p.checkDBFile(); err != nil {
+		return err
+	}
+
+	log.Printf("API token of %s revoked", name)
+	return nil
+}
+
+// APITokens returns every issued token, including revoked ones, oldest first
+func (p *PlutoServer) APITokens() ([]APIToken, error) {
+	rows, err := p.Db.Query("SELECT " + tokenColumns + " FROM api_tokens ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API tokens: %v", err)
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// lookupToken returns the active token matching a presented token, and records its use
+func (p *PlutoServer) lookupToken(token string) (APIToken, error) {
+	row := p.Db.QueryRow("SELECT "+tokenColumns+" FROM api_tokens WHERE hash = ? AND revoked_at IS NULL", hashToken(token))
+	found, err := scanToken(row)
+	if err != nil {
+		return APIToken{}, err
+	}
+
+	p.writes.RLock()
+	defer p.writes.RUnlock()
+	if _, err := p.Db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", formatTime(time.Now()), found.ID); err != nil {
+		log.Printf("Failed to record use of the API token of %s: %v", found.Name, err)
+	}
+	return found, nil
+}
+
+func scanToken(row rowScanner) (APIToken, error) {
+	var token APIToken
+	var sites, createdAt string
+	var lastUsedAt, revokedAt sql.NullString
+
+	err := row.Scan(&token.ID, &token.Name, &token.Role, &sites, &createdAt, &lastUsedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIToken{}, ErrTokenNotFound
+	}
+	if err != nil {
+		return APIToken{}, fmt.Errorf("failed to scan API token: %v", err)
+	}
+
+	if sites != "" {
+		token.Sites = strings.Split(sites, ",")
+	}
+	token.CreatedAt = parseTime(createdAt)
+	if lastUsedAt.Valid {
+		lastUsed := parseTime(lastUsedAt.String)
+		token.LastUsedAt = &lastUsed
+	}
+	if revokedAt.Valid {
+		revoked := parseTime(revokedAt.String)
+		token.RevokedAt = &revoked
+	}
+	return token, nil
+}
+
+// requireToken only lets requests carrying an active API token as a bearer token through. The dashboard files are
+// exempt, they hold no data and ask for a token before calling the API.
+func (p *PlutoServer) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && (r.URL.Path == "/" || strings.HasPrefix(r.URL.Path, "/ui/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			rejectRequest(w, r, "no token")
+			return
+		}
+
+		caller, err := p.lookupToken(token)
+		if err != nil {
+			if errors.Is(err, ErrTokenNotFound) {
+				rejectRequest(w, r, "invalid or revoked token")
+			} else {
+				writeError(w, "Token lookup failed", err)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, caller)))
+	})
+}
+
+func rejectRequest(w http.ResponseWriter, r *http.Request, reason string) {
+	log.Printf("Rejected %s %s from %s: %s", r.Method, r.URL.Path, r.RemoteAddr, reason)
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
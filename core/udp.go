@@ -26,7 +26,20 @@ func (p *PlutoServer) StartUDPServer(port int) error {
 	return nil
 }
 
+// udpQueueSize is the number of datagrams buffered while the handler waits, for example during a key rotation
+const udpQueueSize = 4096
+
+type udpMessage struct {
+	addr    *net.UDPAddr
+	message string
+}
+
+// handleUDPMessages reads datagrams into a queue as they arrive and handles them in order, so the socket keeps being
+// drained while a handler is blocked on the device lock
 func (p *PlutoServer) handleUDPMessages() {
+	queue := make(chan udpMessage, udpQueueSize)
+	go p.processUDPMessages(queue)
+
 	buffer := make([]byte, 64)
 
 	for {
@@ -36,8 +49,18 @@ func (p *PlutoServer) handleUDPMessages() {
 			continue
 		}
 
+		select {
+		case queue <- udpMessage{addr: addr, message: strings.TrimSpace(string(buffer[:n]))}:
+		default:
+			log.Printf("UDP queue full, dropped message from %s", addr.IP)
+		}
+	}
+}
+
+func (p *PlutoServer) processUDPMessages(queue <-chan udpMessage) {
+	for msg := range queue {
+		addr, message := msg.addr, msg.message
 		deviceIP := addr.IP.String()
-		message := strings.TrimSpace(string(buffer[:n]))
 
 		var response StartupResponse
 
@@ -60,7 +83,7 @@ func (p *PlutoServer) handleUDPMessages() {
 
 		if response > 0 {
 			responseMsg := strconv.Itoa(int(response))
-			_, err = p.Conn.WriteToUDP([]byte(responseMsg), addr)
+			_, err := p.Conn.WriteToUDP([]byte(responseMsg), addr)
 			if err != nil {
 				log.Printf("Error sending response to %s: %v", deviceIP, err)
 			}
@@ -0,0 +1,25 @@
+package core
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// uiFiles holds the web dashboard, a set of static pages that read the JSON API from the browser
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves the dashboard files under /ui/
+func uiHandler() http.Handler {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err) // The directory is embedded at build time
+	}
+	return http.StripPrefix("/ui/", http.FileServerFS(files))
+}
+
+func handleUIRedirect(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/ui/", http.StatusFound)
+}
@@ -0,0 +1,284 @@
+// Pluto dashboard. The pages poll the JSON API with the API token kept in the browser, every value is rendered as
+// text so device data is never parsed as HTML.
+var Pluto = (function () {
+  "use strict";
+
+  var REFRESH_MS = 5000;
+  var RECENT_EVENTS = 25;
+  var RESPONSES = ["normal", "due", "approaching", "overdue", "lockout"];
+
+  var TOKEN_KEY = "pluto-token";
+  var prompted = false;
+
+  // askToken asks for the API token issued with "pluto token issue" and keeps it in the browser
+  function askToken() {
+    prompted = true;
+    var token = window.prompt("API token", localStorage.getItem(TOKEN_KEY) || "");
+    if (token !== null) {
+      localStorage.setItem(TOKEN_KEY, token.trim());
+    }
+  }
+
+  function api(path) {
+    var headers = { Accept: "application/json" };
+    var token = localStorage.getItem(TOKEN_KEY);
+    if (token) {
+      headers.Authorization = "Bearer " + token;
+    }
+
+    return fetch(path, { headers: headers }).then(function (resp) {
+      if (resp.status === 401 && !prompted) {
+        askToken();
+      }
+      if (!resp.ok) {
+        return resp.text().then(function (text) {
+          throw new Error(resp.status + " " + text.trim());
+        });
+      }
+      return resp.json();
+    });
+  }
+
+  function el(tag, text, className) {
+    var node = document.createElement(tag);
+    if (text !== undefined && text !== null) {
+      node.textContent = text;
+    }
+    if (className) {
+      node.className = className;
+    }
+    return node;
+  }
+
+  function row(cells) {
+    var tr = document.createElement("tr");
+    cells.forEach(function (cell) {
+      var td = document.createElement("td");
+      if (cell instanceof Node) {
+        td.appendChild(cell);
+      } else {
+        td.textContent = cell;
+      }
+      tr.appendChild(td);
+    });
+    return tr;
+  }
+
+  function replaceRows(tbody, rows, emptyText, columns) {
+    tbody.replaceChildren();
+    if (rows.length === 0) {
+      var td = el("td", emptyText, "muted");
+      td.colSpan = columns;
+      var tr = document.createElement("tr");
+      tr.appendChild(td);
+      tbody.appendChild(tr);
+      return;
+    }
+    rows.forEach(function (tr) {
+      tbody.appendChild(tr);
+    });
+  }
+
+  function formatTime(value) {
+    if (!value || value.indexOf("0001-01-01") === 0) {
+      return "-";
+    }
+    return new Date(value).toLocaleString();
+  }
+
+  function formatAge(seconds) {
+    if (seconds < 60) {
+      return seconds + "s ago";
+    }
+    if (seconds < 3600) {
+      return Math.floor(seconds / 60) + "m ago";
+    }
+    if (seconds < 86400) {
+      return Math.floor(seconds / 3600) + "h ago";
+    }
+    return Math.floor(seconds / 86400) + "d ago";
+  }
+
+  function badge(status) {
+    return el("span", status, "badge status-" + status);
+  }
+
+  function progress(device) {
+    var wrapper = document.createElement("span");
+    var bar = el("span", null, "progress");
+    var fill = el("span", null, "status-" + device.status);
+    fill.style.width = Math.min(device.percent_used, 100) + "%";
+    bar.appendChild(fill);
+    wrapper.appendChild(bar);
+    wrapper.appendChild(el("span", device.percent_used.toFixed(1) + "%", "percent"));
+    return wrapper;
+  }
+
+  function deviceLink(ip) {
+    var link = el("a", ip);
+    link.href = "device.html?ip=" + encodeURIComponent(ip);
+    return link;
+  }
+
+  function responseName(response) {
+    return RESPONSES[response] || String(response);
+  }
+
+  function updated(error) {
+    var node = document.getElementById("updated");
+    if (error) {
+      node.textContent = "Update failed: " + error.message;
+      node.className = "updated error";
+      return;
+    }
+    node.textContent = "Updated " + new Date().toLocaleTimeString();
+    node.className = "updated";
+  }
+
+  function poll(refresh) {
+    document.getElementById("token").addEventListener("click", askToken);
+    var run = function () {
+      refresh().then(function () {
+        updated();
+      }, updated);
+    };
+    run();
+    setInterval(run, REFRESH_MS);
+  }
+
+  function renderStats(stats) {
+    var container = document.getElementById("stats");
+    var figures = [
+      ["Devices", stats.total_devices],
+      ["Active (10 min)", stats.active_devices],
+      ["Approaching", stats.by_status.approaching],
+      ["Due", stats.by_status.due],
+      ["Overdue", stats.by_status.overdue],
+      ["Lockout", stats.by_status.lockout],
+      ["Past lifetime", stats.past_lifetime_limit],
+      ["Decommissioned", stats.decommissioned]
+    ];
+    container.replaceChildren();
+    figures.forEach(function (figure) {
+      var stat = el("div", null, "stat");
+      stat.appendChild(el("div", figure[1], "value"));
+      stat.appendChild(el("div", figure[0], "label"));
+      container.appendChild(stat);
+    });
+  }
+
+  function dashboard() {
+    var devices = [];
+    var filter = document.getElementById("filter");
+    var status = document.getElementById("status");
+
+    function renderDevices() {
+      var needle = filter.value.trim().toLowerCase();
+      var rows = devices.filter(function (device) {
+        if (status.value && device.status !== status.value) {
+          return false;
+        }
+        return !needle || [device.ip, device.serial, device.model, device.site].some(function (value) {
+          return value && value.toLowerCase().indexOf(needle) !== -1;
+        });
+      }).map(function (device) {
+        var tr = row([
+          deviceLink(device.ip), device.serial || "-", device.model || "-", badge(device.status), progress(device),
+          device.current_count, device.effective_threshold, device.total_count, formatAge(device.last_seen_age_seconds)
+        ]);
+        if (device.decommissioned_at && device.decommissioned_at.indexOf("0001-01-01") !== 0) {
+          tr.className = "decommissioned";
+        }
+        return tr;
+      });
+      replaceRows(document.getElementById("devices"), rows, "No devices", 9);
+    }
+
+    filter.addEventListener("input", renderDevices);
+    status.addEventListener("change", renderDevices);
+
+    poll(function () {
+      return Promise.all([
+        api("/api/v1/stats"),
+        api("/api/v1/devices"),
+        api("/api/v1/logs?limit=" + RECENT_EVENTS)
+      ]).then(function (results) {
+        renderStats(results[0]);
+        devices = results[1];
+        renderDevices();
+
+        var rows = results[2].entries.map(function (entry) {
+          return row([formatTime(entry.timestamp), deviceLink(entry.device_ip), entry.action, entry.count_value,
+            responseName(entry.response)]);
+        });
+        replaceRows(document.getElementById("events"), rows, "No events", 5);
+      });
+    });
+  }
+
+  function device(ip) {
+    if (!ip) {
+      updated(new Error("no device selected"));
+      return;
+    }
+    document.getElementById("title").textContent = ip;
+    document.title = "Pluto - " + ip;
+    var path = encodeURIComponent(ip);
+
+    poll(function () {
+      return Promise.all([
+        api("/api/v1/devices/" + path),
+        api("/work-orders?device=" + path),
+        api("/devices/" + path + "/maintenance"),
+        api("/api/v1/logs?limit=" + RECENT_EVENTS + "&device=" + path)
+      ]).then(function (results) {
+        var device = results[0];
+        var details = [
+          ["Status", badge(device.status)],
+          ["Progress", progress(device)],
+          ["Current count", device.current_count],
+          ["Effective threshold", device.effective_threshold],
+          ["Total count", device.total_count + (device.lifetime_exceeded ? " (past lifetime limit)" : "")],
+          ["Serial", device.serial || "-"],
+          ["Model", device.model || "-"],
+          ["Site", device.site || "-"],
+          ["Registered", formatTime(device.registered_at)],
+          ["Last seen", formatTime(device.last_seen) + " (" + formatAge(device.last_seen_age_seconds) + ")"],
+          ["Last maintenance", formatTime(device.last_maintenance)],
+          ["Calendar due date", formatTime(device.due_date)],
+          ["Lockout exemption until", formatTime(device.exempt_until)],
+          ["Deferral", device.deferral ? device.deferral.reason + " (by " + device.deferral.deferred_by + ")" : "-"],
+          ["Decommissioned", formatTime(device.decommissioned_at)]
+        ];
+        var list = document.getElementById("device");
+        list.replaceChildren();
+        details.forEach(function (detail) {
+          list.appendChild(el("dt", detail[0]));
+          var dd = el("dd");
+          if (detail[1] instanceof Node) {
+            dd.appendChild(detail[1]);
+          } else {
+            dd.textContent = detail[1];
+          }
+          list.appendChild(dd);
+        });
+
+        replaceRows(document.getElementById("orders"), results[1].map(function (order) {
+          return row([order.id, order.status, order.reason, order.count_at_open, order.assignee || "-",
+            formatTime(order.opened_at), formatTime(order.updated_at)]);
+        }), "No work orders", 7);
+
+        replaceRows(document.getElementById("maintenance"), results[2].records.slice().reverse().map(function (record) {
+          return row([formatTime(record.performed_at), record.kind, record.technician, record.count_at_reset,
+            record.notes || "-"]);
+        }), "Never serviced", 5);
+
+        replaceRows(document.getElementById("events"), results[3].entries.map(function (entry) {
+          return row([formatTime(entry.timestamp), entry.action, entry.count_value, responseName(entry.response)]);
+        }), "No events", 4);
+      });
+    });
+  }
+
+  return { dashboard: dashboard, device: device };
+})();
@@ -0,0 +1,222 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrWorkOrderNotFound = errors.New("work order not found")
+	ErrInvalidTransition = errors.New("invalid work order transition")
+)
+
+// Work order statuses in lifecycle order
+const (
+	WorkOrderOpen       = "open"
+	WorkOrderAssigned   = "assigned"
+	WorkOrderInProgress = "in_progress"
+	WorkOrderCompleted  = "completed"
+)
+
+// Reasons for opening a work order
+const (
+	WorkOrderReasonThreshold = "threshold" // The trigger count reached the threshold
+	WorkOrderReasonCalendar  = "calendar"  // The maintenance interval elapsed
+)
+
+const workOrderColumns = "id, device_ip, status, reason, count_at_open, assignee, opened_at, updated_at, maintenance_id"
+
+// openWorkOrder opens a work order for a device that became due, unless one is already active for it.
+// It reports whether a new order was opened.
+func (p *PlutoServer) openWorkOrder(device *Device, reason string) (bool, error) {
+	var activeID int64
+	err := p.Db.QueryRow("SELECT id FROM work_orders WHERE device_ip = ? AND status != ?", device.IP, WorkOrderCompleted).Scan(&activeID)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to check work orders for device %s: %v", device.IP, err)
+	}
+
+	query := `
+	INSERT INTO work_orders (device_ip, status, reason, count_at_open, opened_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?)`
+
+	now := formatTime(time.Now())
+	result, err := p.Db.Exec(query, device.IP, WorkOrderOpen, reason, device.CurrentCount, now, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to open work order for device %s: %v", device.IP, err)
+	}
+
+	id, _ := result.LastInsertId()
+	log.Printf("Work order %d opened for device %s (reason: %s, count: %d)", id, device.IP, reason, device.CurrentCount)
+	return true, nil
+}
+
+// WorkOrders lists work orders, oldest first. Empty status or deviceIP match everything.
+func (p *PlutoServer) WorkOrders(status, deviceIP string) ([]WorkOrder, error) {
+	query := "SELECT " + workOrderColumns + " FROM work_orders WHERE 1 = 1"
+	var args []any
+
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	if deviceIP != "" {
+		query += " AND device_ip = ?"
+		args = append(args, deviceIP)
+	}
+	query += " ORDER BY id"
+
+	rows, err := p.Db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query work orders: %v", err)
+	}
+	defer rows.Close()
+
+	orders := []WorkOrder{}
+	for rows.Next() {
+		order, err := scanWorkOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+// WorkOrder returns a single work order by id
+func (p *PlutoServer) WorkOrder(id int64) (WorkOrder, error) {
+	row := p.Db.QueryRow("SELECT "+workOrderColumns+" FROM work_orders WHERE id = ?", id)
+
+	order, err := scanWorkOrder(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return WorkOrder{}, fmt.Errorf("%w: %d", ErrWorkOrderNotFound, id)
+	}
+	return order, err
+}
+
+// AssignWorkOrder hands an open order to a technician. Assigned orders may be reassigned.
+func (p *PlutoServer) AssignWorkOrder(id int64, assignee string) (WorkOrder, error) {
+	assignee = strings.TrimSpace(assignee)
+	if assignee == "" {
+		return WorkOrder{}, fmt.Errorf("%w: assignee is required", ErrInvalidInput)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order, err := p.WorkOrder(id)
+	if err != nil {
+		return WorkOrder{}, err
+	}
+	if order.Status != WorkOrderOpen && order.Status != WorkOrderAssigned {
+		return WorkOrder{}, fmt.Errorf("%w: cannot assign %s order %d", ErrInvalidTransition, order.Status, id)
+	}
+
+	return p.updateWorkOrder(order, WorkOrderAssigned, assignee)
+}
+
+// StartWorkOrder marks an assigned order as being worked on
+func (p *PlutoServer) StartWorkOrder(id int64) (WorkOrder, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order, err := p.WorkOrder(id)
+	if err != nil {
+		return WorkOrder{}, err
+	}
+	if order.Status != WorkOrderAssigned {
+		return WorkOrder{}, fmt.Errorf("%w: cannot start %s order %d", ErrInvalidTransition, order.Status, id)
+	}
+
+	return p.updateWorkOrder(order, WorkOrderInProgress, order.Assignee)
+}
+
+// CompleteWorkOrder finishes an in-progress order by recording the maintenance, which resets the device counter.
+// The technician defaults to the order's assignee.
+func (p *PlutoServer) CompleteWorkOrder(id int64, record MaintenanceRecord) (WorkOrder, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order, err := p.WorkOrder(id)
+	if err != nil {
+		return WorkOrder{}, err
+	}
+	if order.Status != WorkOrderInProgress {
+		return WorkOrder{}, fmt.Errorf("%w: cannot complete %s order %d", ErrInvalidTransition, order.Status, id)
+	}
+
+	if strings.TrimSpace(record.Technician) == "" {
+		record.Technician = order.Assignee
+	}
+	if err := normalizeMaintenanceRecord(&record); err != nil {
+		return WorkOrder{}, err
+	}
+
+	device, exists := p.Devices[order.DeviceIP]
+	if !exists {
+		return WorkOrder{}, fmt.Errorf("%w: %s", ErrDeviceNotFound, order.DeviceIP)
+	}
+
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return WorkOrder{}, fmt.Errorf("failed to begin work order transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// resetDevice completes every active order of the device, this one included
+	if err := resetDevice(tx, device, &record); err != nil {
+		return WorkOrder{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return WorkOrder{}, fmt.Errorf("failed to commit work order %d: %v", id, err)
+	}
+
+	applyReset(device, record)
+	log.Printf("Work order %d completed for %s by %s: current count %d -> 0 (total: %d)",
+		id, device.IP, record.Technician, record.CountAtReset, device.TotalCount)
+
+	return p.WorkOrder(id)
+}
+
+func (p *PlutoServer) updateWorkOrder(order WorkOrder, status, assignee string) (WorkOrder, error) {
+	now := time.Now()
+
+	_, err := p.Db.Exec("UPDATE work_orders SET status = ?, assignee = ?, updated_at = ? WHERE id = ?",
+		status, assignee, formatTime(now), order.ID)
+	if err != nil {
+		return WorkOrder{}, fmt.Errorf("failed to update work order %d: %v", order.ID, err)
+	}
+
+	log.Printf("Work order %d for %s: %s -> %s (assignee: %s)", order.ID, order.DeviceIP, order.Status, status, assignee)
+
+	order.Status = status
+	order.Assignee = assignee
+	order.UpdatedAt = now
+	return order, nil
+}
+
+func scanWorkOrder(row rowScanner) (WorkOrder, error) {
+	var order WorkOrder
+	var openedAt, updatedAt string
+
+	err := row.Scan(&order.ID, &order.DeviceIP, &order.Status, &order.Reason, &order.CountAtOpen, &order.Assignee,
+		&openedAt, &updatedAt, &order.MaintenanceID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return WorkOrder{}, err
+		}
+		return WorkOrder{}, fmt.Errorf("failed to scan work order: %v", err)
+	}
+
+	order.OpenedAt = parseTime(openedAt)
+	order.UpdatedAt = parseTime(updatedAt)
+	return order, nil
+}
@@ -2,6 +2,6 @@ module svrn.com/pluto
 
 go 1.24.4
 
-require github.com/mattn/go-sqlite3 v1.14.28
+require github.com/mutecomm/go-sqlcipher/v4 v4.4.2
 
 replace svrn.com/pluto/core => ./core
@@ -2,28 +2,102 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
 
 	. "svrn.com/pluto/core"
 )
 
+// policyFlags registers the maintenance policy flags on a flag set. The returned function applies the parsed values
+// to a server, so subcommands evaluate devices like the server does.
+func policyFlags(flags *flag.FlagSet) func(server *PlutoServer) {
+	threshold := flags.Int("maintenance-threshold", 5000, "Count threshold value for current count")
+	warningPercent := flags.Int("warning-percent", 0, "Percentage of the threshold at which devices are warned (0 disables)")
+	graceMargin := flags.Int("grace-margin", 0, "Counts past the threshold after which devices are overdue (0 disables)")
+	lockoutMargin := flags.Int("lockout-margin", 0, "Counts past the threshold after which devices are told to refuse operation (0 disables)")
+	intervalDays := flags.Int("maintenance-interval-days", 0, "Days after the last maintenance at which devices are due regardless of count (0 disables)")
+
+	return func(server *PlutoServer) {
+		server.Threshold = *threshold
+		server.WarningPercent = *warningPercent
+		server.GraceMargin = *graceMargin
+		server.IntervalDays = *intervalDays
+		server.LockoutMargin = *lockoutMargin
+	}
+}
+
+// dbKeyFlag registers the database key flag on a flag set. The returned function resolves the key from the key file,
+// the PLUTO_DB_KEY environment variable or a prompt on the terminal, in that order.
+func dbKeyFlag(flags *flag.FlagSet) func() (string, error) {
+	keyFile := flags.String("db-key-file", "", "File holding the database encryption key, readable by its owner only (default: $"+DBKeyEnv+" or a prompt)")
+
+	return func() (string, error) {
+		if *keyFile != "" {
+			return ReadDBKeyFile(*keyFile)
+		}
+		if key := os.Getenv(DBKeyEnv); key != "" {
+			return key, nil
+		}
+		key, err := promptDBKey("Database key")
+		if err != nil {
+			return "", fmt.Errorf("no database key: pass -db-key-file, set %s or enter it on a terminal (%v)", DBKeyEnv, err)
+		}
+		return key, nil
+	}
+}
+
 func main() {
+	if runCommand() {
+		return
+	}
+
 	port := flag.Int("udp-port", 8080, "UDP port to listen on")
 	httpPort := flag.Int("http-port", 8081, "HTTP port for reload API")
-	threshold := flag.Int("maintenance-threshold", 5000, "Count threshold value for current count")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate file of the HTTP server, enables HTTPS and is reloaded when it changes")
+	tlsKey := flag.String("tls-key", "", "PEM private key file of the HTTP server")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "Serve HTTPS with a generated self-signed certificate, written to -tls-cert and -tls-key (default: "+SelfSignedCertFile+" and "+SelfSignedKeyFile+")")
+	tlsClientCA := flag.String("tls-client-ca", "", "PEM file of the CAs that sign client certificates, enables client certificate verification")
+	tlsClientAuth := flag.String("tls-client-auth", "", "Client certificates with -tls-client-ca: require, or optional to also accept clients without one (default: require)")
+	applyPolicy := policyFlags(flag.CommandLine)
+	dbKey := dbKeyFlag(flag.CommandLine)
 	flag.Parse()
+
+	key, err := dbKey()
+	if err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
 	server := &PlutoServer{
-		Devices:   make(map[string]*Device),
-		Threshold: *threshold,
+		Devices: make(map[string]*Device),
+		DBKey:   key,
+		TLS: TLSOptions{
+			CertFile:     *tlsCert,
+			KeyFile:      *tlsKey,
+			SelfSigned:   *tlsSelfSigned,
+			ClientCAFile: *tlsClientCA,
+			ClientAuth:   *tlsClientAuth,
+		},
+	}
+	applyPolicy(server)
+
+	// Held while serving, so an offline rekey cannot replace the database underneath
+	release, err := HoldDatabase("pluto.db")
+	if err != nil {
+		log.Fatalf("Refusing to start: %v", err)
 	}
+	defer release()
 
 	if err := server.InitDB("pluto.db"); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer server.Db.Close()
 
+	if err := server.LoadSettings(); err != nil {
+		log.Fatalf("Failed to load settings: %v", err)
+	}
+
 	if err := server.LoadDevices(); err != nil {
-		log.Printf("Warning: Failed to load devices (this is normal on first run or after password change): %v", err)
+		log.Printf("Warning: Failed to load devices (this is normal on first run): %v", err)
 	}
 
 	if err := server.StartUDPServer(*port); err != nil {
@@ -31,11 +105,13 @@ func main() {
 	}
 	defer server.Conn.Close()
 
-	server.StartHTTPReloadServer(*httpPort)
+	if err := server.StartHTTPReloadServer(*httpPort); err != nil {
+		log.Fatalf("Failed to start HTTP server: %v", err)
+	}
 
 	server.StartPeriodicTasks()
 
-	log.Printf("Pluto server ready - UDP port: %d, maintenance threshold: %d, HTTP reload port: %d", *port, *threshold, *httpPort)
+	log.Printf("Pluto server ready - UDP port: %d, maintenance threshold: %d, HTTP reload port: %d", *port, server.Threshold, *httpPort)
 	server.PrintStats()
 
 	select {}
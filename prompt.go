@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// promptDBKey asks for a database key on the terminal without echoing it
+func promptDBKey(label string) (string, error) {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return "", errors.New("standard input is not a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, label+": ")
+	if err := stty("-echo"); err != nil {
+		return "", fmt.Errorf("failed to disable terminal echo: %v", err)
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	stty("echo")
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read database key: %v", err)
+	}
+
+	key := strings.TrimRight(line, "\r\n")
+	if key == "" {
+		return "", errors.New("empty database key")
+	}
+	return key, nil
+}
+
+func stty(mode string) error {
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
@@ -0,0 +1,105 @@
+package core_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestRoles(t *testing.T) {
+	server := newTestServer(t, "test_roles.db", 5)
+
+	server.HandleCountIncrement("192.168.1.1", 10)
+	server.HandleCountIncrement("192.168.1.2", 10)
+	server.HandleCountIncrement("192.168.1.3", 10)
+
+	if w := doRequest(server, "PUT", "/devices/192.168.1.1/site", []byte(`{"site": "north"}`)); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for the site assignment, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := server.AssignSite("192.168.1.2", "south"); err != nil {
+		t.Fatalf("AssignSite failed: %v", err)
+	}
+	if _, err := server.AssignSite("192.168.1.2", "a,b"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a site with a comma, got %v", err)
+	}
+
+	viewer, _, err := server.IssueToken("wall-screen", RoleViewer, nil)
+	if err != nil {
+		t.Fatalf("IssueToken failed: %v", err)
+	}
+	technician, _, err := server.IssueToken("contractor", RoleTechnician, []string{"north", " "})
+	if err != nil {
+		t.Fatalf("IssueToken failed: %v", err)
+	}
+	if _, _, err := server.IssueToken("nowhere", RoleTechnician, nil); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a technician without sites, got %v", err)
+	}
+	if _, _, err := server.IssueToken("root", "superuser", nil); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an unknown role, got %v", err)
+	}
+
+	request := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.HTTPHandler().ServeHTTP(w, req)
+		return w
+	}
+	maintenance := `{"technician": "Ayse"}`
+
+	// Viewers read device state only
+	if w := request(viewer, "GET", "/api/v1/devices/192.168.1.1", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for a viewer read, got %d", w.Code)
+	}
+	if w := request(viewer, "POST", "/devices/192.168.1.1/maintenance", maintenance); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for maintenance by a viewer, got %d", w.Code)
+	}
+
+	// Technicians only reset the counters of the units at their sites
+	if w := request(technician, "POST", "/devices/192.168.1.2/maintenance", maintenance); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a unit at another site, got %d", w.Code)
+	}
+	if w := request(technician, "POST", "/devices/192.168.1.3/maintenance", maintenance); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a unit without a site, got %d", w.Code)
+	}
+	if server.Devices["192.168.1.2"].CurrentCount != 10 || server.Devices["192.168.1.3"].CurrentCount != 10 {
+		t.Error("Expected the counters of units outside the technician's sites to be unchanged")
+	}
+	if w := request(technician, "POST", "/devices/192.168.1.1/maintenance", maintenance); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for a unit at the technician's site, got %d: %s", w.Code, w.Body.String())
+	}
+
+	orders, _ := server.WorkOrders(WorkOrderOpen, "192.168.1.2")
+	if len(orders) != 1 {
+		t.Fatalf("Expected an open work order for 192.168.1.2, got %d", len(orders))
+	}
+	if w := request(technician, "POST", "/work-orders/"+strconv.FormatInt(orders[0].ID, 10)+"/start", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a work order at another site, got %d", w.Code)
+	}
+
+	// Admin operations are refused to technicians
+	for _, route := range [][3]string{
+		{"POST", "/reload", ""},
+		{"PUT", "/api/v1/settings/threshold", `{"threshold": 50}`},
+		{"DELETE", "/api/v1/devices/192.168.1.1", `{"reason": "test"}`},
+		{"PUT", "/devices/192.168.1.1/threshold", `{"threshold": 50}`},
+	} {
+		if w := request(technician, route[0], route[1], route[2]); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403 for %s %s by a technician, got %d", route[0], route[1], w.Code)
+		}
+	}
+
+	// Admins may do everything, the audit log names their token unless an actor is given
+	if w := doRequest(server, "DELETE", "/api/v1/devices/192.168.1.3", []byte(`{"reason": "stray sender"}`)); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 for a purge by an admin, got %d: %s", w.Code, w.Body.String())
+	}
+	entries, _ := server.AuditLog("192.168.1.3")
+	if len(entries) != 1 || entries[0].Actor != "test" {
+		t.Errorf("Expected the purge to be audited under the token name, got %+v", entries)
+	}
+}
@@ -0,0 +1,80 @@
+package core_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestAPIDevices(t *testing.T) {
+	server := newTestServer(t, "test_api.db", 100)
+	server.WarningPercent = 80
+
+	server.HandleCountIncrement("192.168.1.2", 85)
+	server.HandleCountIncrement("192.168.1.1", 10)
+	server.HandleCountIncrement("192.168.1.3", 120)
+	server.Devices["192.168.1.1"].LastSeen = time.Now().Add(-90 * time.Second)
+
+	w := doRequest(server, "GET", "/api/v1/devices", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected JSON content type, got %s", contentType)
+	}
+
+	var statuses []DeviceStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(statuses) != 3 {
+		t.Fatalf("Expected 3 devices, got %d", len(statuses))
+	}
+
+	expected := []struct {
+		ip      string
+		status  MaintenanceLevel
+		percent float64
+	}{
+		{"192.168.1.1", LevelNormal, 10},
+		{"192.168.1.2", LevelApproaching, 85},
+		{"192.168.1.3", LevelDue, 120},
+	}
+	for i, want := range expected {
+		got := statuses[i]
+		if got.IP != want.ip || got.Status != want.status || got.PercentUsed != want.percent || got.EffectiveThreshold != 100 {
+			t.Errorf("Expected %s %s %.0f%%, got %s %s %.1f%% (threshold %d)",
+				want.ip, want.status, want.percent, got.IP, got.Status, got.PercentUsed, got.EffectiveThreshold)
+		}
+	}
+	if age := statuses[0].LastSeenAgeSeconds; age < 89 || age > 95 {
+		t.Errorf("Expected last seen age around 90 seconds, got %d", age)
+	}
+
+	w = doRequest(server, "GET", "/api/v1/devices?status=due", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].IP != "192.168.1.3" {
+		t.Errorf("Expected only the due device, got %+v", statuses)
+	}
+
+	w = doRequest(server, "GET", "/api/v1/devices/192.168.1.2", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var status DeviceStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if status.IP != "192.168.1.2" || status.CurrentCount != 85 || status.Status != LevelApproaching {
+		t.Errorf("Unexpected device status: %+v", status)
+	}
+
+	if w := doRequest(server, "GET", "/api/v1/devices/10.0.0.1", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown device, got %d", w.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestCalendarMaintenance(t *testing.T) {
+	server := newTestServer(t, "test_calendar.db", 100)
+	server.IntervalDays = 30
+	server.WarningPercent = 90
+
+	now := time.Now()
+	devices := []*Device{
+		{IP: "192.168.1.1", LastSeen: now, RegisteredAt: now.AddDate(0, 0, -40)}, // Past the interval
+		{IP: "192.168.1.2", LastSeen: now, RegisteredAt: now.AddDate(0, 0, -28)}, // Within the warning window
+		{IP: "192.168.1.3", LastSeen: now, RegisteredAt: now.AddDate(0, 0, -5)},  // Recently registered
+		{IP: "192.168.1.4", LastSeen: now.AddDate(0, 0, -35), RegisteredAt: now.AddDate(0, 0, -90),
+			LastMaintenance: now.AddDate(0, 0, -45)}, // Powered off since before it became due
+	}
+	for _, device := range devices {
+		server.Devices[device.IP] = device
+		if err := server.SaveDevice(device); err != nil {
+			t.Fatalf("SaveDevice failed: %v", err)
+		}
+	}
+
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseThresholdReached {
+		t.Errorf("Expected StartupResponseThresholdReached past the interval, got %d", response)
+	}
+	if response := server.HandleStartup("192.168.1.2"); response != StartupResponseApproaching {
+		t.Errorf("Expected StartupResponseApproaching near the interval, got %d", response)
+	}
+	if response := server.HandleStartup("192.168.1.3"); response != StartupResponseNormal {
+		t.Errorf("Expected StartupResponseNormal for a recent device, got %d", response)
+	}
+
+	if opened := server.CheckCalendarDue(); opened != 2 {
+		t.Errorf("Expected 2 calendar work orders, got %d", opened)
+	}
+	if opened := server.CheckCalendarDue(); opened != 0 {
+		t.Errorf("Expected no duplicate work orders, got %d", opened)
+	}
+
+	orders, err := server.WorkOrders(WorkOrderOpen, "192.168.1.4")
+	if err != nil || len(orders) != 1 {
+		t.Fatalf("Expected a work order for the powered off device, got %d (%v)", len(orders), err)
+	}
+	if orders[0].Reason != WorkOrderReasonCalendar {
+		t.Errorf("Expected reason %s, got %s", WorkOrderReasonCalendar, orders[0].Reason)
+	}
+
+	// Maintenance restarts the interval, and the last maintenance survives a restart
+	if _, err := server.RecordMaintenance("192.168.1.1", MaintenanceRecord{Technician: "Ayse"}); err != nil {
+		t.Fatalf("RecordMaintenance failed: %v", err)
+	}
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseNormal {
+		t.Errorf("Expected StartupResponseNormal after maintenance, got %d", response)
+	}
+
+	server.Devices = make(map[string]*Device)
+	if err := server.LoadDevices(); err != nil {
+		t.Fatalf("LoadDevices failed: %v", err)
+	}
+	if server.Devices["192.168.1.1"].LastMaintenance.IsZero() {
+		t.Errorf("Expected last maintenance to be persisted")
+	}
+	if !server.Devices["192.168.1.3"].LastMaintenance.IsZero() {
+		t.Errorf("Expected no last maintenance for a device that was never serviced")
+	}
+
+	// A model interval overrides the server interval
+	if _, err := server.SaveModel(DeviceModel{Name: "MK2", Threshold: 100, IntervalDays: 3}); err != nil {
+		t.Fatalf("SaveModel failed: %v", err)
+	}
+	if _, err := server.AssignModel("192.168.1.3", "MK2"); err != nil {
+		t.Fatalf("AssignModel failed: %v", err)
+	}
+	if response := server.HandleStartup("192.168.1.3"); response != StartupResponseThresholdReached {
+		t.Errorf("Expected StartupResponseThresholdReached from the model interval, got %d", response)
+	}
+	if orders, _ := server.WorkOrders(WorkOrderOpen, "192.168.1.3"); len(orders) != 1 || orders[0].Reason != WorkOrderReasonCalendar {
+		t.Errorf("Expected a calendar work order after the model assignment, got %+v", orders)
+	}
+}
@@ -0,0 +1,94 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"svrn.com/pluto/client"
+)
+
+func TestClient(t *testing.T) {
+	server := newTestServer(t, "test_client.db", 10)
+	httpServer := httptest.NewServer(server.HTTPHandler())
+	defer httpServer.Close()
+
+	ctx := context.Background()
+	c := client.New(httpServer.URL)
+	c.Token = testTokens[server]
+
+	server.HandleCountIncrement("192.168.1.1", 12)
+	server.HandleCountIncrement("192.168.1.2", 3)
+
+	statuses, err := c.ListDevices(ctx, client.DeviceFilter{Status: "due"})
+	if err != nil {
+		t.Fatalf("Failed to list devices: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].IP != "192.168.1.1" || statuses[0].EffectiveThreshold != 10 {
+		t.Errorf("Expected the due device, got %+v", statuses)
+	}
+
+	if _, err := c.SaveModel(ctx, client.DeviceModel{Name: "MK2", Threshold: 20}); err != nil {
+		t.Fatalf("Failed to save model: %v", err)
+	}
+	device, err := c.AssignDeviceModel(ctx, "192.168.1.1", "MK2")
+	if err != nil || device.Model != "MK2" {
+		t.Fatalf("Failed to assign model: %+v %v", device, err)
+	}
+
+	orders, err := c.ListWorkOrders(ctx, "open", "192.168.1.1")
+	if err != nil || len(orders) != 1 {
+		t.Fatalf("Expected one open work order, got %+v %v", orders, err)
+	}
+	if _, err := c.AssignWorkOrder(ctx, orders[0].ID, "A. Yilmaz"); err != nil {
+		t.Fatalf("Failed to assign work order: %v", err)
+	}
+	if _, err := c.StartWorkOrder(ctx, orders[0].ID); err != nil {
+		t.Fatalf("Failed to start work order: %v", err)
+	}
+	order, err := c.CompleteWorkOrder(ctx, orders[0].ID, client.MaintenanceRecord{Technician: "A. Yilmaz"})
+	if err != nil || order.Status != "completed" || order.MaintenanceID == 0 {
+		t.Fatalf("Failed to complete work order: %+v %v", order, err)
+	}
+
+	timeline, err := c.MaintenanceTimeline(ctx, "192.168.1.1")
+	if err != nil || len(timeline.Records) != 1 || timeline.Records[0].CountAtReset != 12 {
+		t.Errorf("Unexpected maintenance timeline: %+v %v", timeline, err)
+	}
+
+	page, err := c.ListLogs(ctx, client.LogQuery{DeviceIP: "192.168.1.1", Action: "increment"})
+	if err != nil || len(page.Entries) != 1 || page.Entries[0].CountValue != 12 {
+		t.Errorf("Unexpected log page: %+v %v", page, err)
+	}
+
+	stats, err := c.GetStats(ctx)
+	if err != nil || stats.TotalDevices != 2 {
+		t.Errorf("Unexpected stats: %+v %v", stats, err)
+	}
+
+	// API errors carry the status code and the server's message
+	_, err = c.GetDevice(ctx, "10.0.0.1")
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 error, got %v", err)
+	}
+	_, err = c.DeferMaintenance(ctx, "192.168.1.2", client.MaintenanceDeferral{DeferredBy: "supervisor"})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a 400 error, got %v", err)
+	}
+
+	streamCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	events, err := c.StreamEvents(streamCtx, "192.168.1.2")
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	server.HandleCountIncrement("192.168.1.2", 2)
+	event, ok := <-events
+	if !ok || event.Type != "increment" || event.CurrentCount != 5 || event.Status != "normal" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+}
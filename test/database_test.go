@@ -13,12 +13,13 @@ func TestDatabaseOperations(t *testing.T) {
 	// Setup
 	server := &PlutoServer{
 		Devices: make(map[string]*Device),
+		DBKey:   testDBKey,
 	}
 
 	// Use a test database
 	dbPath := "test_pluto.db"
 	os.Remove(dbPath) // Clean up any previous test db
-	server.Db, _ = sql.Open("sqlite3", dbPath+"?_crypto_key="+PlutoDBPassword)
+	server.Db, _ = sql.Open("sqlite3", testDSN(dbPath))
 	defer os.Remove(dbPath)
 	defer server.Db.Close()
 
@@ -0,0 +1,124 @@
+package core_test
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestDBKey(t *testing.T) {
+	server := &PlutoServer{Devices: make(map[string]*Device)}
+	if err := server.InitDB("test_nokey.db"); !errors.Is(err, ErrNoDBKey) {
+		t.Errorf("Expected ErrNoDBKey without a key, got %v", err)
+	}
+	if _, err := os.Stat("test_nokey.db"); !os.IsNotExist(err) {
+		os.Remove("test_nokey.db")
+		t.Error("Expected no database to be created without a key")
+	}
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "pluto.key")
+
+	os.WriteFile(keyFile, []byte("site key\n"), 0644)
+	if _, err := ReadDBKeyFile(keyFile); err == nil {
+		t.Error("Expected a key file readable by other users to be refused")
+	}
+
+	os.Chmod(keyFile, 0600)
+	key, err := ReadDBKeyFile(keyFile)
+	if err != nil {
+		t.Fatalf("ReadDBKeyFile failed: %v", err)
+	}
+	if key != "site key" {
+		t.Errorf("Expected the key without its trailing newline, got %q", key)
+	}
+
+	os.WriteFile(keyFile, []byte("\n"), 0600)
+	if _, err := ReadDBKeyFile(keyFile); err == nil {
+		t.Error("Expected an empty key file to be refused")
+	}
+	if _, err := ReadDBKeyFile(dir); err == nil {
+		t.Error("Expected a directory to be refused")
+	}
+	if _, err := ReadDBKeyFile(filepath.Join(dir, "missing.key")); err == nil {
+		t.Error("Expected a missing key file to be refused")
+	}
+}
+
+func TestDBEncryption(t *testing.T) {
+	const dbPath = "test_encryption.db"
+	server := newTestServer(t, dbPath, 5)
+	server.HandleCountIncrement("192.168.1.1", 3)
+
+	header := make([]byte, 16)
+	file, err := os.Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open the database file: %v", err)
+	}
+	file.Read(header)
+	file.Close()
+	if string(header) == "SQLite format 3\x00" {
+		t.Error("Expected the database file to be encrypted")
+	}
+
+	wrong := &PlutoServer{Devices: make(map[string]*Device), DBKey: "wrong key"}
+	if err := wrong.InitDB(dbPath); !errors.Is(err, ErrWrongDBKey) {
+		t.Errorf("Expected ErrWrongDBKey for a wrong key, got %v", err)
+	}
+
+	reopened := &PlutoServer{Devices: make(map[string]*Device), DBKey: testDBKey}
+	if err := reopened.InitDB(dbPath); err != nil {
+		t.Fatalf("Failed to reopen with the right key: %v", err)
+	}
+	defer reopened.Db.Close()
+	if err := reopened.LoadDevices(); err != nil || reopened.Devices["192.168.1.1"] == nil {
+		t.Errorf("Expected the device to load with the right key, got %v", err)
+	}
+}
+
+func TestPlaintextDBUpgrade(t *testing.T) {
+	const dbPath = "test_plaintext.db"
+	os.Remove(dbPath)
+	defer os.Remove(dbPath)
+	defer os.Remove(dbPath + ".lock")
+
+	// Earlier versions wrote the database unencrypted
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create a plain database: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE devices (ip TEXT PRIMARY KEY, current_count INTEGER NOT NULL DEFAULT 0,
+		total_count INTEGER NOT NULL DEFAULT 0, last_seen DATETIME NOT NULL, registered_at DATETIME NOT NULL);
+		INSERT INTO devices VALUES ('192.168.1.1', 4, 40, '2025-06-01 10:00:00', '2025-01-01 10:00:00');`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to fill the plain database: %v", err)
+	}
+
+	server := &PlutoServer{Devices: make(map[string]*Device), DBKey: testDBKey}
+	if err := server.InitDB(dbPath); !errors.Is(err, ErrPlaintextDB) {
+		t.Fatalf("Expected ErrPlaintextDB for an unencrypted database, got %v", err)
+	}
+
+	if _, err := RekeyDatabase(dbPath, "", testDBKey, false); err != nil {
+		t.Fatalf("Failed to encrypt the plain database: %v", err)
+	}
+	if plaintext, err := IsPlaintextDB(dbPath); err != nil || plaintext {
+		t.Errorf("Expected the database to be encrypted, got plaintext=%v, %v", plaintext, err)
+	}
+
+	if err := server.InitDB(dbPath); err != nil {
+		t.Fatalf("Failed to open the encrypted database: %v", err)
+	}
+	defer server.Db.Close()
+	if err := server.LoadDevices(); err != nil {
+		t.Fatalf("LoadDevices failed: %v", err)
+	}
+	if device := server.Devices["192.168.1.1"]; device == nil || device.CurrentCount != 4 || device.TotalCount != 40 {
+		t.Errorf("Expected the device to survive the conversion, got %+v", device)
+	}
+}
@@ -0,0 +1,99 @@
+package core_test
+
+import (
+	"net/http"
+	"testing"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestDecommissionDevice(t *testing.T) {
+	server := newTestServer(t, "test_decommission.db", 10)
+
+	server.HandleCountIncrement("192.168.1.1", 5)
+	server.HandleCountIncrement("192.168.1.2", 5)
+
+	if w := doRequest(server, "POST", "/api/v1/devices/192.168.1.1/decommission", []byte(`{"actor": "ops"}`)); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a reason, got %d", w.Code)
+	}
+
+	w := doRequest(server, "POST", "/api/v1/devices/192.168.1.1/decommission", []byte(`{"actor": "ops", "reason": "retired"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(server, "POST", "/api/v1/devices/192.168.1.1/decommission", []byte(`{"actor": "ops", "reason": "retired"}`)); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a second decommission, got %d", w.Code)
+	}
+
+	// Past the threshold, yet no reply and no work order
+	if response := server.HandleCountIncrement("192.168.1.1", 10); response != StartupResponseNormal {
+		t.Errorf("Expected no reply for a decommissioned device, got %d", response)
+	}
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseNormal {
+		t.Errorf("Expected no startup reply for a decommissioned device, got %d", response)
+	}
+	if orders, _ := server.WorkOrders("", "192.168.1.1"); len(orders) != 0 {
+		t.Errorf("Expected no work order for a decommissioned device, got %d", len(orders))
+	}
+
+	stats := server.Stats()
+	if stats.TotalDevices != 1 || stats.Decommissioned != 1 || stats.TotalCurrentCount != 5 {
+		t.Errorf("Expected the decommissioned device to be left out of stats, got %+v", stats)
+	}
+
+	// The decommission survives a restart and the history is kept
+	server.Devices = make(map[string]*Device)
+	if err := server.LoadDevices(); err != nil {
+		t.Fatalf("Failed to reload devices: %v", err)
+	}
+	device, _ := server.DeviceSnapshot("192.168.1.1")
+	if device.DecommissionedAt.IsZero() || device.TotalCount != 15 {
+		t.Errorf("Expected the decommissioned device to be restored, got %+v", device)
+	}
+	if page, _ := server.QueryLogs(LogQuery{DeviceIP: "192.168.1.1"}); len(page.Entries) != 3 {
+		t.Errorf("Expected 3 log entries to be kept, got %d", len(page.Entries))
+	}
+}
+
+func TestPurgeDevice(t *testing.T) {
+	server := newTestServer(t, "test_purge.db", 10)
+
+	server.HandleCountIncrement("192.168.1.1", 12)
+	server.HandleCountIncrement("192.168.1.2", 3)
+
+	w := doRequest(server, "DELETE", "/api/v1/devices/192.168.1.1", []byte(`{"actor": "ops", "reason": "stray sender"}`))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(server, "DELETE", "/api/v1/devices/192.168.1.1", []byte(`{"actor": "ops", "reason": "stray sender"}`)); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a purged device, got %d", w.Code)
+	}
+
+	if _, exists := server.DeviceSnapshot("192.168.1.1"); exists {
+		t.Error("Expected the device to be removed from memory")
+	}
+	for _, table := range []string{"devices", "logs", "work_orders"} {
+		var count int
+		column := "device_ip"
+		if table == "devices" {
+			column = "ip"
+		}
+		if err := server.Db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE "+column+" = ?", "192.168.1.1").Scan(&count); err != nil {
+			t.Fatalf("Failed to count %s: %v", table, err)
+		}
+		if count != 0 {
+			t.Errorf("Expected no %s rows left for the purged device, got %d", table, count)
+		}
+	}
+	if page, _ := server.QueryLogs(LogQuery{DeviceIP: "192.168.1.2"}); len(page.Entries) != 1 {
+		t.Errorf("Expected the logs of other devices to be kept, got %d", len(page.Entries))
+	}
+
+	entries, err := server.AuditLog("192.168.1.1")
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Action != AuditPurge || entries[0].Actor != "ops" {
+		t.Errorf("Expected one purge audit entry, got %+v", entries)
+	}
+}
@@ -0,0 +1,161 @@
+package core_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestDeferralByTriggerBudget(t *testing.T) {
+	server := newTestServer(t, "test_deferral_budget.db", 100)
+	server.GraceMargin = 50
+
+	server.HandleCountIncrement("192.168.1.1", 100)
+
+	w := doRequest(server, "POST", "/devices/192.168.1.1/deferrals",
+		[]byte(`{"deferred_by": "Maj. Demir", "reason": "exercise week", "extra_triggers": 30}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseNormal {
+		t.Errorf("Expected StartupResponseNormal while deferred, got %d", response)
+	}
+	if response := server.HandleCountIncrement("192.168.1.1", 20); response != StartupResponseNormal {
+		t.Errorf("Expected StartupResponseNormal within the trigger budget, got %d", response)
+	}
+
+	// Deferral survives a restart
+	server.Devices = make(map[string]*Device)
+	if err := server.LoadDevices(); err != nil {
+		t.Fatalf("LoadDevices failed: %v", err)
+	}
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseNormal {
+		t.Errorf("Expected StartupResponseNormal with a persisted deferral, got %d", response)
+	}
+
+	// Using up the budget ends the deferral and reports the real level
+	if response := server.HandleCountIncrement("192.168.1.1", 10); response != StartupResponseThresholdReached {
+		t.Errorf("Expected StartupResponseThresholdReached once the budget is used up, got %d", response)
+	}
+
+	var deferrals []MaintenanceDeferral
+	w = doRequest(server, "GET", "/devices/192.168.1.1/deferrals", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &deferrals); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(deferrals) != 1 || deferrals[0].EndedAt == nil || deferrals[0].EndReason != DeferralEndExpired {
+		t.Errorf("Expected one expired deferral in the history, got %+v", deferrals)
+	}
+	if deferrals[0].CountAtDeferral != 100 || deferrals[0].DeferredBy != "Maj. Demir" {
+		t.Errorf("Unexpected deferral: %+v", deferrals[0])
+	}
+
+	// Cancelling restores the replies immediately
+	if _, err := server.DeferMaintenance("192.168.1.1", MaintenanceDeferral{DeferredBy: "Maj. Demir", Reason: "again", ExtraTriggers: 10}); err != nil {
+		t.Fatalf("DeferMaintenance failed: %v", err)
+	}
+	if w := doRequest(server, "DELETE", "/devices/192.168.1.1/deferrals", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseThresholdReached {
+		t.Errorf("Expected StartupResponseThresholdReached after cancelling, got %d", response)
+	}
+}
+
+func TestDeferralByDate(t *testing.T) {
+	server := newTestServer(t, "test_deferral_date.db", 100)
+	server.LockoutMargin = 500
+
+	server.HandleCountIncrement("192.168.1.1", 100)
+
+	until := time.Now().Add(24 * time.Hour).Format(time.RFC3339)
+	body := fmt.Sprintf(`{"deferred_by": "Maj. Demir", "reason": "spare parts on order", "until": %q}`, until)
+	if w := doRequest(server, "POST", "/devices/192.168.1.1/deferrals", []byte(body)); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if response := server.HandleCountIncrement("192.168.1.1", 100); response != StartupResponseNormal {
+		t.Errorf("Expected StartupResponseNormal before the date, got %d", response)
+	}
+
+	// A deferral never lifts a lockout
+	if response := server.HandleCountIncrement("192.168.1.1", 400); response != StartupResponseLockout {
+		t.Errorf("Expected StartupResponseLockout despite the deferral, got %d", response)
+	}
+
+	// Passing the date expires the deferral automatically
+	expired := time.Now().Add(-time.Minute)
+	server.Devices["192.168.1.1"].Deferral.Until = &expired
+	server.Devices["192.168.1.1"].CurrentCount = 150
+	server.ExpireDeferrals()
+	if server.Devices["192.168.1.1"].Deferral != nil {
+		t.Errorf("Expected the deferral to expire")
+	}
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseThresholdReached {
+		t.Errorf("Expected StartupResponseThresholdReached after expiry, got %d", response)
+	}
+
+	// Maintenance ends an active deferral
+	if _, err := server.DeferMaintenance("192.168.1.1", MaintenanceDeferral{DeferredBy: "Maj. Demir", Reason: "again", ExtraTriggers: 10}); err != nil {
+		t.Fatalf("DeferMaintenance failed: %v", err)
+	}
+	if _, err := server.RecordMaintenance("192.168.1.1", MaintenanceRecord{Technician: "Ayse"}); err != nil {
+		t.Fatalf("RecordMaintenance failed: %v", err)
+	}
+	deferrals, _ := server.Deferrals("192.168.1.1")
+	if len(deferrals) != 2 || deferrals[1].EndReason != DeferralEndMaintenance {
+		t.Errorf("Expected the deferral to end with the maintenance, got %+v", deferrals)
+	}
+
+	if w := doRequest(server, "DELETE", "/devices/192.168.1.1/deferrals", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without an active deferral, got %d", w.Code)
+	}
+
+	for _, body := range []string{
+		`{"reason": "missing supervisor", "extra_triggers": 10}`,
+		`{"deferred_by": "Demir", "extra_triggers": 10}`,
+		`{"deferred_by": "Demir", "reason": "no limit"}`,
+		`{"deferred_by": "Demir", "reason": "past", "until": "2020-01-01T00:00:00Z"}`,
+	} {
+		if w := doRequest(server, "POST", "/devices/192.168.1.1/deferrals", []byte(body)); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestDeferralHidesOnlyReplies(t *testing.T) {
+	server := newTestServer(t, "test_deferral_crossing.db", 100)
+
+	server.HandleCountIncrement("192.168.1.1", 50)
+	until := time.Now().Add(time.Hour)
+	if _, err := server.DeferMaintenance("192.168.1.1", MaintenanceDeferral{DeferredBy: "Maj. Demir", Reason: "exercise week",
+		Until: &until}); err != nil {
+		t.Fatalf("DeferMaintenance failed: %v", err)
+	}
+
+	// The crossing happens during the deferral, the device is not told but the work order opens
+	if response := server.HandleCountIncrement("192.168.1.1", 60); response != StartupResponseNormal {
+		t.Errorf("Expected StartupResponseNormal while deferred, got %d", response)
+	}
+	orders, _ := server.WorkOrders(WorkOrderOpen, "192.168.1.1")
+	if len(orders) != 1 {
+		t.Errorf("Expected a work order for the crossing during the deferral, got %d", len(orders))
+	}
+
+	// Once the date passed, the next update tells the device it is due
+	expired := time.Now().Add(-time.Minute)
+	server.Devices["192.168.1.1"].Deferral.Until = &expired
+	if response := server.HandleCountIncrement("192.168.1.1", 1); response != StartupResponseThresholdReached {
+		t.Errorf("Expected StartupResponseThresholdReached after the deferral ended, got %d", response)
+	}
+	if response := server.HandleCountIncrement("192.168.1.1", 1); response != StartupResponseNormal {
+		t.Errorf("Expected the due level to be reported once, got %d", response)
+	}
+	if orders, _ := server.WorkOrders(WorkOrderOpen, "192.168.1.1"); len(orders) != 1 {
+		t.Errorf("Expected still one open work order, got %d", len(orders))
+	}
+}
@@ -15,12 +15,13 @@ func TestDeviceOperations(t *testing.T) {
 
 	server := &PlutoServer{
 		Devices:   make(map[string]*Device),
+		DBKey:     testDBKey,
 		Threshold: 10,
 	}
 
 	// Initialize test database
 	var err error
-	server.Db, err = sql.Open("sqlite3", dbPath+"?_crypto_key="+PlutoDBPassword)
+	server.Db, err = sql.Open("sqlite3", testDSN(dbPath))
 	if err != nil {
 		t.Fatalf("Failed to open test database: %v", err)
 	}
@@ -0,0 +1,99 @@
+package core_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestDeviceModels(t *testing.T) {
+	server := newTestServer(t, "test_models.db", 100)
+	server.WarningPercent = 90
+
+	server.HandleStartup("192.168.1.1")
+	server.HandleStartup("192.168.1.2")
+
+	w := doRequest(server, "PUT", "/models/MK2", []byte(`{"threshold": 20, "warning_percent": 50, "lifetime_limit": 60}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doRequest(server, "PUT", "/devices/192.168.1.1/model", []byte(`{"model": "MK2"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Model warning percentage and threshold apply to assigned devices only
+	if response := server.HandleCountIncrement("192.168.1.1", 10); response != StartupResponseApproaching {
+		t.Errorf("Expected StartupResponseApproaching from model policy, got %d", response)
+	}
+	if response := server.HandleCountIncrement("192.168.1.1", 10); response != StartupResponseThresholdReached {
+		t.Errorf("Expected StartupResponseThresholdReached from model threshold, got %d", response)
+	}
+	if response := server.HandleCountIncrement("192.168.1.2", 20); response != StartupResponseNormal {
+		t.Errorf("Expected StartupResponseNormal for unassigned device, got %d", response)
+	}
+
+	// Device override wins over the model
+	if _, err := server.SetDeviceThreshold("192.168.1.1", 50); err != nil {
+		t.Fatalf("SetDeviceThreshold failed: %v", err)
+	}
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseNormal {
+		t.Errorf("Expected StartupResponseNormal with device override, got %d", response)
+	}
+
+	// Lowering the model threshold makes assigned units due
+	if _, err := server.SetDeviceThreshold("192.168.1.1", 0); err != nil {
+		t.Fatalf("SetDeviceThreshold failed: %v", err)
+	}
+	if _, err := server.RecordMaintenance("192.168.1.1", MaintenanceRecord{Technician: "Ayse"}); err != nil {
+		t.Fatalf("RecordMaintenance failed: %v", err)
+	}
+	server.HandleCountIncrement("192.168.1.1", 5)
+	if _, err := server.SaveModel(DeviceModel{Name: "MK2", Threshold: 5, LifetimeLimit: 60}); err != nil {
+		t.Fatalf("SaveModel failed: %v", err)
+	}
+	if orders, _ := server.WorkOrders(WorkOrderOpen, "192.168.1.1"); len(orders) != 1 {
+		t.Errorf("Expected a work order after lowering the model threshold, got %d", len(orders))
+	}
+
+	// Models and assignments survive a restart
+	server.Devices = make(map[string]*Device)
+	server.Models = nil
+	if err := server.LoadDevices(); err != nil {
+		t.Fatalf("LoadDevices failed: %v", err)
+	}
+	if server.Devices["192.168.1.1"].Model != "MK2" || server.Models["MK2"] == nil {
+		t.Errorf("Expected model assignment to be persisted")
+	}
+
+	w = doRequest(server, "GET", "/models", nil)
+	var models []DeviceModel
+	if err := json.Unmarshal(w.Body.Bytes(), &models); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(models) != 1 || models[0].Threshold != 5 || models[0].LifetimeLimit != 60 {
+		t.Errorf("Unexpected models: %+v", models)
+	}
+
+	// Validation and referential checks
+	cases := []struct {
+		method, path, body string
+		want               int
+	}{
+		{"PUT", "/models/MK3", `{"threshold": 0}`, http.StatusBadRequest},
+		{"PUT", "/models/MK3", `{"threshold": 10, "warning_percent": 120}`, http.StatusBadRequest},
+		{"PUT", "/devices/192.168.1.2/model", `{"model": "MK9"}`, http.StatusNotFound},
+		{"DELETE", "/models/MK2", ``, http.StatusConflict},
+		{"DELETE", "/models/MK9", ``, http.StatusNotFound},
+		{"PUT", "/devices/192.168.1.1/model", `{"model": ""}`, http.StatusOK},
+		{"DELETE", "/models/MK2", ``, http.StatusNoContent},
+	}
+	for _, c := range cases {
+		if w := doRequest(server, c.method, c.path, []byte(c.body)); w.Code != c.want {
+			t.Errorf("%s %s %s: expected status %d, got %d", c.method, c.path, c.body, c.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package core_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "svrn.com/pluto/core"
+)
+
+// readEvent reads the next Server-Sent Event from a stream, skipping keep-alive comments
+func readEvent(t *testing.T, reader *bufio.Reader) Event {
+	t.Helper()
+
+	var name, data string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "" && data != "":
+			var event Event
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatalf("Failed to decode event %q: %v", data, err)
+			}
+			if string(event.Type) != name {
+				t.Errorf("Expected event name %s to match type %s", name, event.Type)
+			}
+			return event
+		}
+	}
+}
+
+func TestEventZeroCount(t *testing.T) {
+	server := newTestServer(t, "test_events_zero.db", 10)
+	server.HandleCountIncrement("192.168.1.1", 12)
+	if _, err := server.RecordMaintenance("192.168.1.1", MaintenanceRecord{Technician: "Ayse"}); err != nil {
+		t.Fatalf("RecordMaintenance failed: %v", err)
+	}
+
+	events, unsubscribe := server.SubscribeEvents("192.168.1.1")
+	defer unsubscribe()
+	server.HandleStartup("192.168.1.1")
+
+	// A count of 0 right after the maintenance reset is sent, not left out like the fields of other event types
+	select {
+	case event := <-events:
+		data, err := json.Marshal(event)
+		if err != nil {
+			t.Fatalf("Failed to encode event: %v", err)
+		}
+		if event.Type != EventStartup || !strings.Contains(string(data), `"current_count":0`) {
+			t.Errorf("Expected a startup event with current_count 0, got %s", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a startup event")
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	server := newTestServer(t, "test_events.db", 10)
+	httpServer := httptest.NewServer(server.HTTPHandler())
+	defer httpServer.Close()
+
+	// The client timeout also bounds reading the stream, a missing event fails instead of hanging
+	client := &http.Client{Timeout: 5 * time.Second}
+	req, _ := http.NewRequest("GET", httpServer.URL+"/api/v1/events?device=192.168.1.1", nil)
+	req.Header.Set("Authorization", "Bearer "+testTokens[server])
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("Expected event stream content type, got %s", contentType)
+	}
+
+	server.HandleStartup("192.168.1.1")
+	server.HandleStartup("192.168.1.2") // Filtered out
+	server.HandleCountIncrement("192.168.1.1", 4)
+	server.HandleCountIncrement("192.168.1.1", 8)
+	if w := doRequest(server, "POST", "/reload", nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 from reload, got %d", w.Code)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	if event := readEvent(t, reader); event.Type != EventStartup || event.DeviceIP != "192.168.1.1" || *event.Response != StartupResponseNormal {
+		t.Errorf("Unexpected startup event: %+v", event)
+	}
+	if event := readEvent(t, reader); event.Type != EventIncrement || event.Increment != 4 || event.CurrentCount != 4 {
+		t.Errorf("Unexpected increment event: %+v", event)
+	}
+	if event := readEvent(t, reader); event.Type != EventIncrement || event.CurrentCount != 12 || *event.Status != LevelDue {
+		t.Errorf("Unexpected increment event: %+v", event)
+	}
+	if event := readEvent(t, reader); event.Type != EventThresholdCrossing || *event.PreviousStatus != LevelNormal || *event.Status != LevelDue {
+		t.Errorf("Unexpected crossing event: %+v", event)
+	}
+	// Reloads concern every device and reach filtered subscribers too
+	if event := readEvent(t, reader); event.Type != EventReload || event.Devices != 2 {
+		t.Errorf("Unexpected reload event: %+v", event)
+	}
+}
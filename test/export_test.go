@@ -0,0 +1,122 @@
+package core_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestExport(t *testing.T) {
+	server := newTestServer(t, "test_export.db", 10)
+
+	server.HandleCountIncrement("192.168.1.1", 12)
+	server.HandleCountIncrement("192.168.1.2", 3)
+	if _, err := server.RecordMaintenance("192.168.1.1", MaintenanceRecord{Technician: "A. Yilmaz", Notes: "lens, cleaned"}); err != nil {
+		t.Fatalf("RecordMaintenance failed: %v", err)
+	}
+
+	w := doRequest(server, "GET", "/api/v1/export/devices", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/csv" {
+		t.Errorf("Expected CSV content type, got %s", contentType)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV export: %v", err)
+	}
+	if len(records) != 3 || records[0][0] != "ip" || records[1][0] != "192.168.1.1" || records[1][4] != "12" {
+		t.Errorf("Unexpected devices export: %v", records)
+	}
+
+	w = doRequest(server, "GET", "/api/v1/export/maintenance", nil)
+	records, err = csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV export: %v", err)
+	}
+	if len(records) != 2 || records[1][3] != "12" || records[1][6] != "lens, cleaned" {
+		t.Errorf("Unexpected maintenance export: %v", records)
+	}
+
+	w = doRequest(server, "GET", "/api/v1/export/logs?format=ndjson", nil)
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("Expected NDJSON content type, got %s", contentType)
+	}
+	var actions []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var entry LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Failed to decode NDJSON line %q: %v", scanner.Text(), err)
+		}
+		actions = append(actions, entry.Action)
+	}
+	if len(actions) != 3 || actions[0] != "increment+12" || actions[2] != "maintenance" {
+		t.Errorf("Expected the logs oldest first, got %v", actions)
+	}
+
+	from := time.Now().Add(time.Hour)
+	var buf bytes.Buffer
+	if err := server.Export(&buf, ExportQuery{Dataset: ExportLogs, Format: ExportNDJSON, From: from}); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no logs after %s, got %s", from.Format(time.RFC3339), buf.String())
+	}
+
+	if w := doRequest(server, "GET", "/api/v1/export/users", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown dataset, got %d", w.Code)
+	}
+	if w := doRequest(server, "GET", "/api/v1/export/logs?format=xml", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown format, got %d", w.Code)
+	}
+}
+
+// hookWriter runs a function on its first write, while an export is in progress
+type hookWriter struct {
+	bytes.Buffer
+	hook func()
+}
+
+func (w *hookWriter) Write(b []byte) (int, error) {
+	if w.hook != nil {
+		w.hook()
+		w.hook = nil
+	}
+	return w.Buffer.Write(b)
+}
+
+func TestExportDoesNotBlockUpdates(t *testing.T) {
+	server := newTestServer(t, "test_export_lock.db", 10)
+
+	for i := 0; i < 600; i++ {
+		server.SaveLog("192.168.1.1", "increment+1", i+1, 0)
+	}
+	server.HandleCountIncrement("192.168.1.1", 1)
+
+	for _, dataset := range []string{ExportDevices, ExportLogs, ExportMaintenance} {
+		var updateErr error
+		out := &hookWriter{hook: func() {
+			// A slow client is still reading while the fleet keeps reporting
+			_, updateErr = server.Db.Exec("UPDATE devices SET current_count = current_count + 1 WHERE ip = '192.168.1.1'")
+		}}
+		if err := server.Export(out, ExportQuery{Dataset: dataset, Format: ExportNDJSON}); err != nil {
+			t.Fatalf("Export of %s failed: %v", dataset, err)
+		}
+		if updateErr != nil {
+			t.Errorf("Expected updates to go through during a %s export, got %v", dataset, updateErr)
+		}
+		if dataset == ExportLogs {
+			if lines := bytes.Count(out.Bytes(), []byte("\n")); lines != 601 {
+				t.Errorf("Expected 601 exported logs across batches, got %d", lines)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package core_test
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestForecasts(t *testing.T) {
+	server := newTestServer(t, "test_forecast.db", 100)
+
+	registered := time.Now().AddDate(0, 0, -30)
+	for _, ip := range []string{"192.168.1.1", "192.168.1.2", "192.168.1.3", "192.168.1.4"} {
+		device := &Device{IP: ip, LastSeen: time.Now(), RegisteredAt: registered}
+		server.Devices[ip] = device
+		server.SaveDevice(device)
+	}
+
+	// 70 triggers in the window: 5 per day, 30 remaining -> 6 days
+	server.HandleCountIncrement("192.168.1.1", 30)
+	server.HandleCountIncrement("192.168.1.1", 40)
+	// 28 triggers in the window: 2 per day, 72 remaining -> 36 days
+	server.HandleCountIncrement("192.168.1.2", 28)
+	// Already due
+	server.HandleCountIncrement("192.168.1.4", 150)
+
+	// History outside the window is ignored, also from a later day of the month or a later time of day
+	utc3Location := time.FixedZone("UTC+3", 3*3600)
+	for _, at := range []time.Time{time.Now().AddDate(0, 0, -20), time.Now().AddDate(-1, 0, 0).Add(time.Hour)} {
+		old := at.In(utc3Location).Format("15:04:05 02/01/2006")
+		_, err := server.Db.Exec("INSERT INTO logs (device_ip, action, count_value, timestamp, response) VALUES (?, ?, ?, ?, ?)",
+			"192.168.1.3", "increment+500", 500, old, 0)
+		if err != nil {
+			t.Fatalf("Failed to insert old log: %v", err)
+		}
+	}
+
+	w := doRequest(server, "GET", "/forecasts", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var forecasts []Forecast
+	if err := json.Unmarshal(w.Body.Bytes(), &forecasts); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(forecasts) != 4 {
+		t.Fatalf("Expected 4 forecasts, got %d", len(forecasts))
+	}
+
+	order := []string{"192.168.1.4", "192.168.1.1", "192.168.1.2", "192.168.1.3"}
+	for i, ip := range order {
+		if forecasts[i].IP != ip {
+			t.Errorf("Expected %s at position %d, got %s", ip, i, forecasts[i].IP)
+		}
+	}
+
+	expectDays := map[string]float64{"192.168.1.4": 0, "192.168.1.1": 6, "192.168.1.2": 36}
+	for _, forecast := range forecasts {
+		want, projected := expectDays[forecast.IP]
+		if !projected {
+			if forecast.DaysRemaining != nil || forecast.ProjectedDate != nil || forecast.DailyRate != 0 {
+				t.Errorf("Expected no projection for idle device %s, got %+v", forecast.IP, forecast)
+			}
+			continue
+		}
+		if forecast.DaysRemaining == nil || math.Abs(*forecast.DaysRemaining-want) > 0.01 {
+			t.Errorf("Expected %.0f days remaining for %s, got %v", want, forecast.IP, forecast.DaysRemaining)
+		}
+	}
+
+	if w := doRequest(server, "GET", "/forecasts?window_days=0", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an empty window, got %d", w.Code)
+	}
+
+	server.PrintStats()
+}
@@ -0,0 +1,70 @@
+package core_test
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	. "svrn.com/pluto/core"
+)
+
+// testDBKey is the database key of the test databases, with characters that need escaping in a DSN
+const testDBKey = "test key & more #1"
+
+// testDSN returns the data source name of a test database opened with testDBKey
+func testDSN(dbPath string) string {
+	return dbPath + "?_pragma_key=" + url.QueryEscape(testDBKey)
+}
+
+// newTestServer returns a server backed by a fresh database file that is removed when the test ends
+func newTestServer(t *testing.T, dbPath string, threshold int) *PlutoServer {
+	t.Helper()
+	os.Remove(dbPath)
+
+	server := &PlutoServer{
+		Devices:   make(map[string]*Device),
+		DBKey:     testDBKey,
+		Threshold: threshold,
+	}
+
+	var err error
+	server.Db, err = sql.Open("sqlite3", testDSN(dbPath))
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := server.InitDB(dbPath); err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+
+	token, _, err := server.IssueToken("test", RoleAdmin, nil)
+	if err != nil {
+		t.Fatalf("Failed to issue test API token: %v", err)
+	}
+	testTokens[server] = token
+
+	t.Cleanup(func() {
+		delete(testTokens, server)
+		server.Db.Close()
+		os.Remove(dbPath)
+	})
+
+	return server
+}
+
+// testTokens holds the API token issued to each server created by newTestServer
+var testTokens = make(map[*PlutoServer]string)
+
+// doRequest sends a request through the server's HTTP handler, authorized with the server's test token when it has
+// one, and returns the recorded response
+func doRequest(server *PlutoServer, method, path string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	if token, ok := testTokens[server]; ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(w, req)
+	return w
+}
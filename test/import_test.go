@@ -0,0 +1,165 @@
+package core_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestImportDevices(t *testing.T) {
+	server := newTestServer(t, "test_import.db", 100)
+	server.HandleStartup("192.168.1.1")
+	if _, err := server.SaveModel(DeviceModel{Name: "MK2", Threshold: 50}); err != nil {
+		t.Fatalf("SaveModel failed: %v", err)
+	}
+
+	valid := "ip,serial,model,current_count,total_count\n" +
+		"10.0.0.1,SN-001,MK2,10,4000\n" +
+		"10.0.0.2,SN-002,,120\n" +
+		"10.0.0.3\n"
+
+	w := doRequest(server, "POST", "/api/v1/devices/import?dry_run=true", []byte(valid))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for a dry run, got %d: %s", w.Code, w.Body.String())
+	}
+	var result ImportResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !result.DryRun || len(result.Devices) != 3 || len(result.Errors) != 0 {
+		t.Errorf("Unexpected dry run result: %+v", result)
+	}
+	if _, exists := server.DeviceSnapshot("10.0.0.1"); exists {
+		t.Error("Expected a dry run to register nothing")
+	}
+
+	invalid := "ip,serial,current_count,total_count\n" +
+		"10.0.0.4,SN-004,5,5\n" +
+		"not-an-ip,SN-005,0,0\n" +
+		"192.168.1.1,SN-006,0,0\n" +
+		"10.0.0.7,SN-004,0,0\n" +
+		"10.0.0.8,SN-008,9,3\n"
+
+	w = doRequest(server, "POST", "/api/v1/devices/import", []byte(invalid))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for invalid rows, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	var lines []int
+	for _, importErr := range result.Errors {
+		lines = append(lines, importErr.Line)
+	}
+	if len(lines) != 4 || lines[0] != 3 || lines[3] != 6 {
+		t.Errorf("Expected errors on lines 3 to 6, got %+v", result.Errors)
+	}
+	if _, exists := server.DeviceSnapshot("10.0.0.4"); exists {
+		t.Error("Expected an import with invalid rows to register nothing")
+	}
+
+	w = doRequest(server, "POST", "/api/v1/devices/import", []byte(valid))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	device, exists := server.DeviceSnapshot("10.0.0.1")
+	if !exists || device.Serial != "SN-001" || device.Model != "MK2" || device.CurrentCount != 10 || device.TotalCount != 4000 {
+		t.Errorf("Unexpected imported device: %+v", device)
+	}
+	if device, _ := server.DeviceSnapshot("10.0.0.2"); device.TotalCount != 120 {
+		t.Errorf("Expected the total count to default to the current count, got %d", device.TotalCount)
+	}
+
+	// A unit migrated past its threshold gets a work order right away
+	if orders, _ := server.WorkOrders(WorkOrderOpen, "10.0.0.2"); len(orders) != 1 {
+		t.Errorf("Expected a work order for the due import, got %d", len(orders))
+	}
+
+	// Imported devices survive a restart
+	server.Devices = make(map[string]*Device)
+	if err := server.LoadDevices(); err != nil {
+		t.Fatalf("Failed to reload devices: %v", err)
+	}
+	if device, _ := server.DeviceSnapshot("10.0.0.1"); device.Serial != "SN-001" || device.TotalCount != 4000 {
+		t.Errorf("Unexpected device after restart: %+v", device)
+	}
+
+	w = doRequest(server, "POST", "/api/v1/devices/import", []byte("address,serial\n10.0.0.9,SN-009\n"))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unknown column") {
+		t.Errorf("Expected an unknown column to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestImportUploadLimits(t *testing.T) {
+	server := newTestServer(t, "test_import_limits.db", 100)
+
+	// A stalled upload does not hold up the counters
+	body, upload := io.Pipe()
+	done := make(chan error)
+	go func() {
+		_, err := server.ImportDevices(body, false)
+		done <- err
+	}()
+	upload.Write([]byte("ip,serial\n10.0.0.1,SN-001\n"))
+
+	counted := make(chan struct{})
+	go func() {
+		server.HandleCountIncrement("192.168.1.1", 1)
+		close(counted)
+	}()
+	select {
+	case <-counted:
+	case <-time.After(2 * time.Second):
+		t.Error("Expected increments to be handled while an import is still uploading")
+	}
+
+	upload.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("ImportDevices failed: %v", err)
+	}
+	if _, exists := server.DeviceSnapshot("10.0.0.1"); !exists {
+		t.Error("Expected the device to be imported once the upload finished")
+	}
+
+	large := "ip\n" + strings.Repeat("10.0.0.2\n", MaxImportSize/9+1)
+	w := doRequest(server, "POST", "/api/v1/devices/import", []byte(large))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for an oversized import, got %d", w.Code)
+	}
+	if _, exists := server.DeviceSnapshot("10.0.0.2"); exists {
+		t.Error("Expected an oversized import to register nothing")
+	}
+}
+
+func TestImportCanonicalIP(t *testing.T) {
+	server := newTestServer(t, "test_import_ip.db", 100)
+
+	result, err := server.ImportDevices(strings.NewReader("ip,serial\n2001:0DB8:0:0:0:0:0:0001,SN-001\n"), false)
+	if err != nil || len(result.Errors) != 0 {
+		t.Fatalf("ImportDevices failed: %v %+v", err, result.Errors)
+	}
+	if len(result.Devices) != 1 || result.Devices[0].IP != "2001:db8::1" {
+		t.Fatalf("Expected the address to be stored as 2001:db8::1, got %+v", result.Devices)
+	}
+
+	// The first startup finds the imported unit instead of registering it again
+	server.HandleStartup("2001:db8::1")
+	if len(server.Devices) != 1 {
+		t.Errorf("Expected a single device after the startup, got %d", len(server.Devices))
+	}
+	if device, _ := server.DeviceSnapshot("2001:db8::1"); device.Serial != "SN-001" {
+		t.Errorf("Expected the imported serial on the started unit, got %+v", device)
+	}
+
+	// The same unit written differently is a duplicate of the registered one
+	result, err = server.ImportDevices(strings.NewReader("ip\n2001:db8:0::1\n"), true)
+	if err != nil || len(result.Errors) != 1 {
+		t.Errorf("Expected the re-import to be reported as already registered, got %v %+v", err, result.Errors)
+	}
+}
@@ -14,13 +14,14 @@ func TestIntegration(t *testing.T) {
 	// Create a complete server instance
 	server := &PlutoServer{
 		Devices:   make(map[string]*Device),
+		DBKey:     testDBKey,
 		Threshold: 5,
 	}
 
 	// Initialize with test database
 	dbPath := "test_integration.db"
 	os.Remove(dbPath)
-	server.Db, _ = sql.Open("sqlite3", dbPath+"?_crypto_key="+PlutoDBPassword)
+	server.Db, _ = sql.Open("sqlite3", testDSN(dbPath))
 	defer os.Remove(dbPath)
 	defer server.Db.Close()
 
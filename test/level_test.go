@@ -0,0 +1,59 @@
+package core_test
+
+import (
+	"testing"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestMaintenanceLevels(t *testing.T) {
+	server := newTestServer(t, "test_levels.db", 100)
+	server.WarningPercent = 80
+	server.GraceMargin = 20
+
+	steps := []struct {
+		name      string
+		increment int
+		want      StartupResponse
+	}{
+		{"Below warning", 50, StartupResponseNormal},
+		{"Approaching", 30, StartupResponseApproaching},
+		{"Still approaching", 10, StartupResponseNormal},
+		{"Due", 10, StartupResponseThresholdReached},
+		{"Still due", 10, StartupResponseNormal},
+		{"Overdue", 10, StartupResponseOverdue},
+		{"Still overdue", 10, StartupResponseNormal},
+	}
+
+	for _, step := range steps {
+		if response := server.HandleCountIncrement("192.168.1.1", step.increment); response != step.want {
+			t.Errorf("%s: expected response %d, got %d", step.name, step.want, response)
+		}
+	}
+
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseOverdue {
+		t.Errorf("Expected StartupResponseOverdue on startup, got %d", response)
+	}
+
+	// Jumping straight past the grace margin still opens a work order
+	server.HandleCountIncrement("192.168.1.2", 500)
+	if orders, _ := server.WorkOrders(WorkOrderOpen, "192.168.1.2"); len(orders) != 1 {
+		t.Errorf("Expected 1 open work order for overdue device, got %d", len(orders))
+	}
+
+	server.PrintStats()
+}
+
+func TestMaintenanceLevelsDisabled(t *testing.T) {
+	server := newTestServer(t, "test_levels_disabled.db", 100)
+
+	if response := server.HandleCountIncrement("192.168.1.1", 99); response != StartupResponseNormal {
+		t.Errorf("Expected StartupResponseNormal without warning percent, got %d", response)
+	}
+	if response := server.HandleCountIncrement("192.168.1.1", 500); response != StartupResponseThresholdReached {
+		t.Errorf("Expected StartupResponseThresholdReached without grace margin, got %d", response)
+	}
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseThresholdReached {
+		t.Errorf("Expected StartupResponseThresholdReached on startup without grace margin, got %d", response)
+	}
+}
@@ -0,0 +1,93 @@
+package core_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestLockout(t *testing.T) {
+	server := newTestServer(t, "test_lockout.db", 100)
+	server.GraceMargin = 10
+	server.LockoutMargin = 50
+
+	server.HandleStartup("192.168.1.1")
+	if response := server.HandleCountIncrement("192.168.1.1", 120); response != StartupResponseOverdue {
+		t.Errorf("Expected StartupResponseOverdue below the lockout margin, got %d", response)
+	}
+	if response := server.HandleCountIncrement("192.168.1.1", 30); response != StartupResponseLockout {
+		t.Errorf("Expected StartupResponseLockout when crossing the lockout margin, got %d", response)
+	}
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseLockout {
+		t.Errorf("Expected StartupResponseLockout on startup, got %d", response)
+	}
+
+	// Exemption lifts the lockout
+	expiresAt := time.Now().Add(48 * time.Hour).Format(time.RFC3339)
+	body := fmt.Sprintf(`{"granted_by": "Cmdr. Kaya", "reason": "exercise Anatolian Eagle", "expires_at": %q}`, expiresAt)
+	w := doRequest(server, "POST", "/devices/192.168.1.1/exemptions", []byte(body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseOverdue {
+		t.Errorf("Expected StartupResponseOverdue with an exemption, got %d", response)
+	}
+
+	// Exemption survives a restart
+	server.Devices = make(map[string]*Device)
+	if err := server.LoadDevices(); err != nil {
+		t.Fatalf("LoadDevices failed: %v", err)
+	}
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseOverdue {
+		t.Errorf("Expected StartupResponseOverdue with a persisted exemption, got %d", response)
+	}
+
+	// Revocation restores the lockout
+	if w := doRequest(server, "DELETE", "/devices/192.168.1.1/exemptions", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseLockout {
+		t.Errorf("Expected StartupResponseLockout after revocation, got %d", response)
+	}
+	if w := doRequest(server, "DELETE", "/devices/192.168.1.1/exemptions", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without an active exemption, got %d", w.Code)
+	}
+
+	// Expired exemptions do not apply
+	server.Devices["192.168.1.1"].ExemptUntil = time.Now().Add(-time.Minute)
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseLockout {
+		t.Errorf("Expected StartupResponseLockout after expiry, got %d", response)
+	}
+
+	w = doRequest(server, "GET", "/devices/192.168.1.1/exemptions", nil)
+	var exemptions []LockoutExemption
+	if err := json.Unmarshal(w.Body.Bytes(), &exemptions); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(exemptions) != 1 || exemptions[0].RevokedAt == nil || exemptions[0].GrantedBy != "Cmdr. Kaya" {
+		t.Errorf("Unexpected exemption history: %+v", exemptions)
+	}
+
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	for _, body := range []string{
+		`{"reason": "missing grantor", "expires_at": "` + expiresAt + `"}`,
+		`{"granted_by": "Kaya", "expires_at": "` + expiresAt + `"}`,
+		`{"granted_by": "Kaya", "reason": "already expired", "expires_at": "` + past + `"}`,
+	} {
+		if w := doRequest(server, "POST", "/devices/192.168.1.1/exemptions", []byte(body)); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestLockoutDisabled(t *testing.T) {
+	server := newTestServer(t, "test_lockout_disabled.db", 100)
+
+	if response := server.HandleCountIncrement("192.168.1.1", 10000); response != StartupResponseThresholdReached {
+		t.Errorf("Expected StartupResponseThresholdReached without a lockout margin, got %d", response)
+	}
+}
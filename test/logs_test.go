@@ -0,0 +1,131 @@
+package core_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestAPILogs(t *testing.T) {
+	server := newTestServer(t, "test_logs.db", 10)
+
+	server.HandleStartup("192.168.1.1")
+	for i := 0; i < 5; i++ {
+		server.HandleCountIncrement("192.168.1.1", 3)
+	}
+	server.HandleStartup("192.168.1.2")
+	server.HandleCountIncrement("192.168.1.2", 1)
+
+	decode := func(path string) LogPage {
+		t.Helper()
+		w := doRequest(server, "GET", path, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", path, w.Code, w.Body.String())
+		}
+		var page LogPage
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return page
+	}
+
+	if page := decode("/api/v1/logs"); len(page.Entries) != 8 || page.NextCursor != 0 {
+		t.Errorf("Expected 8 entries on a single page, got %d (next %d)", len(page.Entries), page.NextCursor)
+	}
+
+	// Device and action prefix filters
+	page := decode("/api/v1/logs?device=192.168.1.1&action=increment")
+	if len(page.Entries) != 5 {
+		t.Errorf("Expected 5 increments of 192.168.1.1, got %d", len(page.Entries))
+	}
+	for _, entry := range page.Entries {
+		if entry.DeviceIP != "192.168.1.1" || !strings.HasPrefix(entry.Action, "increment+") {
+			t.Errorf("Unexpected entry: %+v", entry)
+		}
+	}
+
+	// Wildcards in the action match literally
+	for _, action := range []string{"%25", "incr_ment", "increment%25"} {
+		if page := decode("/api/v1/logs?action=" + action); len(page.Entries) != 0 {
+			t.Errorf("Expected no entries for the action %s, got %d", action, len(page.Entries))
+		}
+	}
+
+	// Response filter: the crossing increment only
+	page = decode(fmt.Sprintf("/api/v1/logs?response=%d&action=increment", StartupResponseThresholdReached))
+	if len(page.Entries) != 1 || page.Entries[0].CountValue != 12 {
+		t.Errorf("Expected the single threshold crossing, got %+v", page.Entries)
+	}
+
+	// Cursor pagination walks every entry exactly once, newest first
+	seen := make(map[int64]bool)
+	var lastID int64
+	path := "/api/v1/logs?limit=3"
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatalf("Pagination did not terminate")
+		}
+		page := decode(path)
+		for _, entry := range page.Entries {
+			if seen[entry.ID] || (lastID != 0 && entry.ID > lastID) {
+				t.Errorf("Entry %d out of order or repeated", entry.ID)
+			}
+			seen[entry.ID] = true
+			lastID = entry.ID
+		}
+		if page.NextCursor == 0 {
+			break
+		}
+		path = fmt.Sprintf("/api/v1/logs?limit=3&cursor=%d", page.NextCursor)
+	}
+	if len(seen) != 8 {
+		t.Errorf("Expected 8 entries across pages, got %d", len(seen))
+	}
+
+	// Time range
+	future := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	past := url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339))
+	if page := decode("/api/v1/logs?from=" + future); len(page.Entries) != 0 {
+		t.Errorf("Expected no entries from the future, got %d", len(page.Entries))
+	}
+	if page := decode("/api/v1/logs?from=" + past + "&to=" + future); len(page.Entries) != 8 {
+		t.Errorf("Expected 8 entries within the last hour, got %d", len(page.Entries))
+	}
+	if page := decode("/api/v1/logs?to=" + past); len(page.Entries) != 0 || page.NextCursor != 0 {
+		t.Errorf("Expected no entries before the last hour, got %d", len(page.Entries))
+	}
+
+	// CSV
+	w := doRequest(server, "GET", "/api/v1/logs?format=csv&device=192.168.1.2&limit=1", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("Expected CSV response, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(records) != 2 || records[0][0] != "id" || records[1][2] != "increment+1" {
+		t.Errorf("Unexpected CSV: %v", records)
+	}
+	if w.Header().Get("X-Next-Cursor") == "0" {
+		t.Errorf("Expected a next cursor for the truncated CSV page")
+	}
+
+	for _, path := range []string{
+		"/api/v1/logs?from=yesterday",
+		"/api/v1/logs?limit=5000",
+		"/api/v1/logs?format=xml",
+		"/api/v1/logs?cursor=abc",
+	} {
+		if w := doRequest(server, "GET", path, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", path, w.Code)
+		}
+	}
+}
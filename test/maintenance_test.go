@@ -0,0 +1,122 @@
+package core_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestRecordMaintenance(t *testing.T) {
+	server := newTestServer(t, "test_maintenance.db", 5)
+
+	server.HandleStartup("192.168.1.1")
+	server.HandleCountIncrement("192.168.1.1", 7)
+
+	body := []byte(`{"technician": "Ayse", "kind": "routine", "notes": "lens cleaned"}`)
+
+	// Unknown device
+	w := doRequest(server, "POST", "/devices/10.0.0.1/maintenance", body)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown device, got %d", w.Code)
+	}
+
+	// Wrong method
+	w = doRequest(server, "PUT", "/devices/192.168.1.1/maintenance", body)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for PUT, got %d", w.Code)
+	}
+
+	// Missing technician
+	w = doRequest(server, "POST", "/devices/192.168.1.1/maintenance", []byte(`{"kind": "repair"}`))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without technician, got %d", w.Code)
+	}
+
+	// Reset
+	w = doRequest(server, "POST", "/devices/192.168.1.1/maintenance", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var device Device
+	if err := json.Unmarshal(w.Body.Bytes(), &device); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if device.CurrentCount != 0 || device.TotalCount != 7 {
+		t.Errorf("Expected current=0 total=7 in response, got current=%d total=%d", device.CurrentCount, device.TotalCount)
+	}
+
+	// Database must agree with memory
+	var current, total int
+	err := server.Db.QueryRow("SELECT current_count, total_count FROM devices WHERE ip = ?", "192.168.1.1").Scan(&current, &total)
+	if err != nil {
+		t.Fatalf("Failed to query device: %v", err)
+	}
+	if current != 0 || total != 7 {
+		t.Errorf("Expected current=0 total=7 in database, got current=%d total=%d", current, total)
+	}
+
+	var countAtReset int
+	err = server.Db.QueryRow("SELECT count_value FROM logs WHERE device_ip = ? AND action = 'maintenance'", "192.168.1.1").Scan(&countAtReset)
+	if err != nil {
+		t.Fatalf("Expected a maintenance log row: %v", err)
+	}
+	if countAtReset != 7 {
+		t.Errorf("Expected logged count 7, got %d", countAtReset)
+	}
+
+	// Counting resumes from zero and the threshold is reachable again
+	if response := server.HandleCountIncrement("192.168.1.1", 5); response != StartupResponseThresholdReached {
+		t.Errorf("Expected StartupResponseThresholdReached after reset, got %d", response)
+	}
+}
+
+func TestMaintenanceTimeline(t *testing.T) {
+	server := newTestServer(t, "test_timeline.db", 5)
+
+	server.HandleStartup("192.168.1.1")
+	server.HandleCountIncrement("192.168.1.1", 6)
+	if _, err := server.RecordMaintenance("192.168.1.1", MaintenanceRecord{Technician: "Ayse"}); err != nil {
+		t.Fatalf("RecordMaintenance failed: %v", err)
+	}
+	server.HandleCountIncrement("192.168.1.1", 3)
+	record := MaintenanceRecord{Technician: "Mehmet", Kind: MaintenanceKindRepair, Notes: "replaced diode"}
+	if _, err := server.RecordMaintenance("192.168.1.1", record); err != nil {
+		t.Fatalf("RecordMaintenance failed: %v", err)
+	}
+
+	w := doRequest(server, "GET", "/devices/192.168.1.1/maintenance", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var timeline MaintenanceTimeline
+	if err := json.Unmarshal(w.Body.Bytes(), &timeline); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(timeline.Records) != 2 {
+		t.Fatalf("Expected 2 maintenance records, got %d", len(timeline.Records))
+	}
+
+	first, second := timeline.Records[0], timeline.Records[1]
+	if first.Technician != "Ayse" || first.Kind != MaintenanceKindRoutine || first.CountAtReset != 6 {
+		t.Errorf("Unexpected first record: %+v", first)
+	}
+	if second.Technician != "Mehmet" || second.Kind != MaintenanceKindRepair || second.CountAtReset != 3 || second.Notes != "replaced diode" {
+		t.Errorf("Unexpected second record: %+v", second)
+	}
+	if timeline.TotalCount != 9 || timeline.CurrentCount != 0 {
+		t.Errorf("Expected current=0 total=9, got current=%d total=%d", timeline.CurrentCount, timeline.TotalCount)
+	}
+	if first.PerformedAt.Before(timeline.RegisteredAt.Truncate(time.Second)) {
+		t.Errorf("Maintenance recorded before registration: %v < %v", first.PerformedAt, timeline.RegisteredAt)
+	}
+
+	w = doRequest(server, "GET", "/devices/10.0.0.1/maintenance", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown device, got %d", w.Code)
+	}
+}
@@ -0,0 +1,99 @@
+package core_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestOpenAPIRoutes(t *testing.T) {
+	server := newTestServer(t, "test_openapi.db", 100)
+
+	w := doRequest(server, "GET", "/api/v1/openapi.json", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if !bytes.Equal(w.Body.Bytes(), OpenAPISpec) {
+		t.Error("Expected the embedded OpenAPI document")
+	}
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Failed to decode OpenAPI document: %v", err)
+	}
+	if len(spec.Paths) == 0 {
+		t.Fatal("Expected documented paths")
+	}
+
+	// A cancelled context ends the event stream right after its headers are written
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	handler := server.HTTPHandler()
+	replacer := strings.NewReplacer("{ip}", "10.9.9.9", "{id}", "999999", "{name}", "undocumented")
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			if method == "parameters" {
+				continue
+			}
+
+			req := httptest.NewRequest(strings.ToUpper(method), replacer.Replace(path), strings.NewReader("{}")).WithContext(ctx)
+			req.Header.Set("Authorization", "Bearer "+testTokens[server])
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			// The mux answers unknown routes with its default page and wrong methods with 405
+			if w.Code == http.StatusMethodNotAllowed || strings.HasPrefix(w.Body.String(), "404 page not found") {
+				t.Errorf("Documented operation %s %s is not routed (status %d)", strings.ToUpper(method), path, w.Code)
+			}
+		}
+	}
+	// Every route is documented, the dashboard aside. A wildcard of a route may stand for several documented paths,
+	// a route without a method for any documented method.
+	for _, pattern := range server.HTTPRoutes() {
+		if pattern == "GET /ui/" || pattern == "GET /{$}" {
+			continue
+		}
+		method, path, found := strings.Cut(pattern, " ")
+		if !found {
+			method, path = "", pattern
+		}
+
+		documented := false
+		for specPath, operations := range spec.Paths {
+			if !matchesRoute(path, specPath) {
+				continue
+			}
+			for specMethod := range operations {
+				if specMethod != "parameters" && (method == "" || strings.EqualFold(method, specMethod)) {
+					documented = true
+				}
+			}
+		}
+		if !documented {
+			t.Errorf("Route %s is missing from the OpenAPI document", pattern)
+		}
+	}
+}
+
+// matchesRoute reports whether a documented path is served by a route path, whose wildcards match any segment
+func matchesRoute(routePath, specPath string) bool {
+	route, spec := strings.Split(routePath, "/"), strings.Split(specPath, "/")
+	if len(route) != len(spec) {
+		return false
+	}
+	for i := range route {
+		if route[i] != spec[i] && !strings.HasPrefix(route[i], "{") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,204 @@
+package core_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	. "svrn.com/pluto/core"
+)
+
+// openWithKey loads the devices of a database file with the given key
+func openWithKey(t *testing.T, dbPath, key string) *PlutoServer {
+	t.Helper()
+
+	server := &PlutoServer{Devices: make(map[string]*Device), DBKey: key}
+	if err := server.InitDB(dbPath); err != nil {
+		t.Fatalf("Failed to open %s: %v", dbPath, err)
+	}
+	t.Cleanup(func() { server.Db.Close() })
+	if err := server.LoadDevices(); err != nil {
+		t.Fatalf("Failed to load devices: %v", err)
+	}
+	return server
+}
+
+func TestRekeyDatabase(t *testing.T) {
+	const dbPath = "test_rekey.db"
+	server := newTestServer(t, dbPath, 5)
+
+	server.HandleStartup("192.168.1.1")
+	server.HandleCountIncrement("192.168.1.1", 7)
+	server.HandleCountIncrement("192.168.1.2", 2)
+	if _, err := server.AssignSite("192.168.1.1", "north"); err != nil {
+		t.Fatalf("AssignSite failed: %v", err)
+	}
+	if _, err := server.RecordMaintenance("192.168.1.1", MaintenanceRecord{Technician: "Ayse", Notes: "new spring"}); err != nil {
+		t.Fatalf("RecordMaintenance failed: %v", err)
+	}
+	before := openWithKey(t, dbPath, testDBKey).Devices["192.168.1.1"]
+	server.Db.Close()
+
+	if _, err := RekeyDatabase(dbPath, testDBKey, testDBKey, false); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an unchanged key, got %v", err)
+	}
+	if _, err := RekeyDatabase(dbPath, testDBKey, "", false); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an empty key, got %v", err)
+	}
+	if _, err := RekeyDatabase("test_rekey_missing.db", testDBKey, "new key", false); err == nil {
+		os.Remove("test_rekey_missing.db")
+		t.Error("Expected an error for a missing database")
+	}
+
+	// A server still serving the database keeps the offline rekey out
+	release, err := HoldDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("HoldDatabase failed: %v", err)
+	}
+	defer os.Remove(dbPath + ".lock")
+	if _, err := RekeyDatabase(dbPath, testDBKey, "new key", false); !errors.Is(err, ErrDBInUse) {
+		t.Errorf("Expected ErrDBInUse while a server holds the database, got %v", err)
+	}
+	if releaseOther, err := HoldDatabase(dbPath); err != nil {
+		t.Errorf("Expected servers to share the database lock, got %v", err)
+	} else {
+		releaseOther()
+	}
+	release()
+
+	result, err := RekeyDatabase(dbPath, testDBKey, "new key", false)
+	if err != nil {
+		t.Fatalf("RekeyDatabase failed: %v", err)
+	}
+	if result.Tables == 0 || result.Rows == 0 {
+		t.Errorf("Expected tables and rows to be copied, got %+v", result)
+	}
+	if result.Backup != "" {
+		t.Errorf("Expected no backup to be kept, got %s", result.Backup)
+	}
+	for _, leftover := range []string{dbPath + ".old", dbPath + ".rekey"} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			os.Remove(leftover)
+			t.Errorf("Expected %s to be removed", leftover)
+		}
+	}
+
+	stale := &PlutoServer{Devices: make(map[string]*Device), DBKey: testDBKey}
+	if err := stale.InitDB(dbPath); !errors.Is(err, ErrWrongDBKey) {
+		t.Errorf("Expected ErrWrongDBKey for the old key after the rekey, got %v", err)
+	}
+
+	rekeyed := openWithKey(t, dbPath, "new key")
+	after := rekeyed.Devices["192.168.1.1"]
+	if after == nil {
+		t.Fatal("Expected 192.168.1.1 to survive the rekey")
+	}
+	if after.CurrentCount != before.CurrentCount || after.TotalCount != before.TotalCount || after.Site != "north" {
+		t.Errorf("Expected counters and site to be copied, got %+v", after)
+	}
+	if !after.RegisteredAt.Equal(before.RegisteredAt) || !after.LastMaintenance.Equal(before.LastMaintenance) {
+		t.Errorf("Expected timestamps to be copied unchanged, got %v and %v", after.RegisteredAt, after.LastMaintenance)
+	}
+	if len(rekeyed.Devices) != 2 {
+		t.Errorf("Expected 2 devices, got %d", len(rekeyed.Devices))
+	}
+
+	// New rows continue after the copied ids
+	var lastID, count int
+	rekeyed.Db.QueryRow("SELECT MAX(id), COUNT(*) FROM logs").Scan(&lastID, &count)
+	rekeyed.HandleCountIncrement("192.168.1.2", 1)
+	var nextID int
+	rekeyed.Db.QueryRow("SELECT MAX(id) FROM logs").Scan(&nextID)
+	if count == 0 || nextID <= lastID {
+		t.Errorf("Expected copied logs and a new id after %d, got %d logs and id %d", lastID, count, nextID)
+	}
+
+	result, err = RekeyDatabase(dbPath, "new key", "newer key", true)
+	if err != nil {
+		t.Fatalf("RekeyDatabase with a backup failed: %v", err)
+	}
+	defer os.Remove(dbPath + ".old")
+	if result.Backup != dbPath+".old" {
+		t.Errorf("Expected the backup %s.old, got %q", dbPath, result.Backup)
+	}
+	if _, err := os.Stat(result.Backup); err != nil {
+		t.Errorf("Expected the backup to exist: %v", err)
+	}
+}
+
+func TestRekeyAPI(t *testing.T) {
+	const dbPath = "test_rekey_api.db"
+	server := newTestServer(t, dbPath, 5)
+	defer os.Remove(dbPath + ".old")
+
+	server.HandleCountIncrement("192.168.1.1", 3)
+
+	viewer, _, err := server.IssueToken("wall-screen", RoleViewer, nil)
+	if err != nil {
+		t.Fatalf("IssueToken failed: %v", err)
+	}
+	if _, _, err := server.IssueToken("contractor", RoleViewer, nil); err != nil {
+		t.Fatalf("IssueToken failed: %v", err)
+	}
+
+	// A token command of another process that opened the database before the rekey
+	other := &PlutoServer{Devices: make(map[string]*Device), DBKey: testDBKey}
+	if err := other.InitDB(dbPath); err != nil {
+		t.Fatalf("Failed to open the database a second time: %v", err)
+	}
+	defer other.Db.Close()
+	request := func(token, remoteAddr, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/database/rekey", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		server.HTTPHandler().ServeHTTP(w, req)
+		return w
+	}
+	admin := testTokens[server]
+
+	if w := request(viewer, "127.0.0.1:40000", `{"new_key": "new key"}`); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a viewer, got %d", w.Code)
+	}
+	if w := request(admin, "192.0.2.1:40000", `{"new_key": "new key"}`); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a key sent over plain HTTP from another host, got %d", w.Code)
+	}
+	if w := request(admin, "127.0.0.1:40000", `{"new_key": ""}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an empty key, got %d", w.Code)
+	}
+	if server.DBKey != testDBKey {
+		t.Fatal("Expected the key to be unchanged by rejected requests")
+	}
+
+	w := request(admin, "127.0.0.1:40000", `{"new_key": "new key"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if server.DBKey != "new key" {
+		t.Error("Expected the server to use the new key")
+	}
+	stale := &PlutoServer{Devices: make(map[string]*Device), DBKey: testDBKey}
+	if err := stale.InitDB(dbPath); !errors.Is(err, ErrWrongDBKey) {
+		t.Errorf("Expected ErrWrongDBKey for the old key after the rekey, got %v", err)
+	}
+
+	// The revoke lands in the replaced file, so it must not be reported as done
+	if err := other.RevokeToken("contractor"); !errors.Is(err, ErrDBReplaced) {
+		t.Errorf("Expected ErrDBReplaced for a revoke racing the rekey, got %v", err)
+	}
+	if err := server.RevokeToken("contractor"); err != nil {
+		t.Errorf("Expected the token to be still active in the new file, got %v", err)
+	}
+
+	// The running server keeps working on the new file
+	server.HandleCountIncrement("192.168.1.1", 4)
+	if w := doRequest(server, "GET", "/api/v1/devices/192.168.1.1", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the admin token to work after the rekey, got %d", w.Code)
+	}
+	if device := openWithKey(t, dbPath, "new key").Devices["192.168.1.1"]; device == nil || device.CurrentCount != 7 {
+		t.Errorf("Expected the increment after the rekey in the new file, got %+v", device)
+	}
+}
@@ -0,0 +1,95 @@
+package core_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestSetThreshold(t *testing.T) {
+	server := newTestServer(t, "test_settings.db", 100)
+
+	server.HandleCountIncrement("192.168.1.1", 60)
+	server.HandleCountIncrement("192.168.1.2", 20)
+	server.HandleCountIncrement("192.168.1.3", 70)
+	if _, err := server.SetDeviceThreshold("192.168.1.3", 200); err != nil {
+		t.Fatalf("SetDeviceThreshold failed: %v", err)
+	}
+
+	body := strings.NewReader(`{"threshold": 50}`)
+	req := httptest.NewRequest("PUT", "/api/v1/settings/threshold", body)
+	w := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without a token, got %d", w.Code)
+	}
+	if server.Threshold != 100 {
+		t.Fatalf("Expected the threshold to be unchanged, got %d", server.Threshold)
+	}
+
+	w = doRequest(server, "PUT", "/api/v1/settings/threshold", []byte(`{"threshold": 0}`))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a zero threshold, got %d", w.Code)
+	}
+
+	w = doRequest(server, "PUT", "/api/v1/settings/threshold", []byte(`{"threshold": 50}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var change ThresholdChange
+	if err := json.Unmarshal(w.Body.Bytes(), &change); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	// The device with its own threshold is not affected
+	if change.Previous != 100 || change.Threshold != 50 || len(change.NewlyDue) != 1 || change.NewlyDue[0] != "192.168.1.1" {
+		t.Errorf("Unexpected threshold change: %+v", change)
+	}
+	if orders, _ := server.WorkOrders(WorkOrderOpen, "192.168.1.1"); len(orders) != 1 {
+		t.Errorf("Expected a work order for the newly due device, got %d", len(orders))
+	}
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseThresholdReached {
+		t.Errorf("Expected the new threshold to apply immediately, got %d", response)
+	}
+
+	// The stored threshold replaces the configured one after a restart
+	restarted := &PlutoServer{Db: server.Db, Devices: make(map[string]*Device), Threshold: 100}
+	if err := restarted.LoadSettings(); err != nil {
+		t.Fatalf("LoadSettings failed: %v", err)
+	}
+	if restarted.Threshold != 50 {
+		t.Errorf("Expected the stored threshold 50, got %d", restarted.Threshold)
+	}
+
+	w = doRequest(server, "GET", "/api/v1/settings", nil)
+	var settings Settings
+	if err := json.Unmarshal(w.Body.Bytes(), &settings); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if settings.Threshold != 50 {
+		t.Errorf("Expected threshold 50 in settings, got %+v", settings)
+	}
+
+	// Clearing the stored threshold returns to the configured one, also after a restart
+	w = doRequest(server, "DELETE", "/api/v1/settings/threshold", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &change); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if change.Previous != 50 || change.Threshold != 100 || server.Threshold != 100 {
+		t.Errorf("Expected the threshold to return from 50 to 100, got %+v", change)
+	}
+	restarted = &PlutoServer{Db: server.Db, Devices: make(map[string]*Device), Threshold: 120}
+	if err := restarted.LoadSettings(); err != nil {
+		t.Fatalf("LoadSettings failed: %v", err)
+	}
+	if restarted.Threshold != 120 {
+		t.Errorf("Expected the configured threshold 120 once the stored one is cleared, got %d", restarted.Threshold)
+	}
+}
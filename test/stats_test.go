@@ -0,0 +1,57 @@
+package core_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestFleetStats(t *testing.T) {
+	server := newTestServer(t, "test_stats.db", 100)
+	server.WarningPercent = 80
+
+	server.HandleCountIncrement("192.168.1.1", 10)
+	server.HandleCountIncrement("192.168.1.2", 85)
+	server.HandleCountIncrement("192.168.1.3", 120)
+	server.HandleCountIncrement("192.168.1.4", 5)
+	server.Devices["192.168.1.2"].LastSeen = time.Now().Add(-30 * time.Minute)
+	server.Devices["192.168.1.3"].LastSeen = time.Now().Add(-3 * 24 * time.Hour)
+	server.Devices["192.168.1.4"].LastSeen = time.Now().Add(-30 * 24 * time.Hour)
+
+	w := doRequest(server, "GET", "/api/v1/stats", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var stats FleetStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if stats.TotalDevices != 4 || stats.ActiveDevices != 1 || stats.BelowThreshold != 3 || stats.AboveThreshold != 1 {
+		t.Errorf("Unexpected totals: %+v", stats)
+	}
+	if stats.TotalCurrentCount != 220 || stats.GrandTotalCount != 220 {
+		t.Errorf("Expected counts 220/220, got %d/%d", stats.TotalCurrentCount, stats.GrandTotalCount)
+	}
+
+	expectedStatus := map[string]int{"normal": 2, "approaching": 1, "due": 1, "overdue": 0, "lockout": 0}
+	for status, want := range expectedStatus {
+		if got, ok := stats.ByStatus[status]; !ok || got != want {
+			t.Errorf("Expected %d %s devices, got %d", want, status, got)
+		}
+	}
+
+	expectedActivity := map[string]int{"last_10m": 1, "last_1h": 1, "last_24h": 0, "last_7d": 1, "older": 1}
+	for window, want := range expectedActivity {
+		if got, ok := stats.ByActivity[window]; !ok || got != want {
+			t.Errorf("Expected %d devices in %s, got %d", want, window, got)
+		}
+	}
+
+	// The periodic log line is computed from the same figures
+	server.PrintStats()
+}
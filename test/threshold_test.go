@@ -0,0 +1,122 @@
+package core_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestDeviceThresholdOverride(t *testing.T) {
+	server := newTestServer(t, "test_threshold.db", 100)
+
+	server.HandleStartup("192.168.1.1")
+	server.HandleStartup("192.168.1.2")
+
+	w := doRequest(server, "PUT", "/devices/192.168.1.1/threshold", []byte(`{"threshold": 10}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var device Device
+	if err := json.Unmarshal(w.Body.Bytes(), &device); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if device.Threshold != 10 {
+		t.Errorf("Expected threshold 10 in response, got %d", device.Threshold)
+	}
+
+	// Override applies to the configured device only
+	if response := server.HandleCountIncrement("192.168.1.1", 10); response != StartupResponseThresholdReached {
+		t.Errorf("Expected StartupResponseThresholdReached with override, got %d", response)
+	}
+	if response := server.HandleCountIncrement("192.168.1.2", 10); response != StartupResponseNormal {
+		t.Errorf("Expected StartupResponseNormal with global threshold, got %d", response)
+	}
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseThresholdReached {
+		t.Errorf("Expected StartupResponseThresholdReached on startup with override, got %d", response)
+	}
+
+	// Override survives a restart
+	server.Devices = make(map[string]*Device)
+	if err := server.LoadDevices(); err != nil {
+		t.Fatalf("LoadDevices failed: %v", err)
+	}
+	if server.Devices["192.168.1.1"].Threshold != 10 {
+		t.Errorf("Expected persisted threshold 10, got %d", server.Devices["192.168.1.1"].Threshold)
+	}
+
+	// Lowering the threshold below the current count makes the device due
+	w = doRequest(server, "PUT", "/devices/192.168.1.2/threshold", []byte(`{"threshold": 5}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if orders, _ := server.WorkOrders(WorkOrderOpen, "192.168.1.2"); len(orders) != 1 {
+		t.Errorf("Expected a work order after lowering the threshold, got %d", len(orders))
+	}
+
+	// Clearing restores the global threshold
+	w = doRequest(server, "PUT", "/devices/192.168.1.1/threshold", []byte(`{"threshold": 0}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if response := server.HandleStartup("192.168.1.1"); response != StartupResponseNormal {
+		t.Errorf("Expected StartupResponseNormal after clearing override, got %d", response)
+	}
+
+	for _, body := range []string{`{}`, `{"threshold": -1}`} {
+		if w := doRequest(server, "PUT", "/devices/192.168.1.1/threshold", []byte(body)); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, w.Code)
+		}
+	}
+	if w := doRequest(server, "PUT", "/devices/10.0.0.1/threshold", []byte(`{"threshold": 5}`)); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown device, got %d", w.Code)
+	}
+}
+
+func TestDevicesTableMigration(t *testing.T) {
+	dbPath := "test_migration.db"
+	os.Remove(dbPath)
+	defer os.Remove(dbPath)
+
+	// Schema and data as written by the first release
+	db, err := sql.Open("sqlite3", testDSN(dbPath))
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	_, err = db.Exec(`
+	CREATE TABLE devices (
+		ip TEXT PRIMARY KEY,
+		current_count INTEGER NOT NULL DEFAULT 0,
+		total_count INTEGER NOT NULL DEFAULT 0,
+		last_seen DATETIME NOT NULL,
+		registered_at DATETIME NOT NULL
+	);
+	INSERT INTO devices VALUES ('192.168.1.1', 7, 70, '2025-01-02 10:00:00', '2024-06-01 09:30:00');`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+
+	server := &PlutoServer{Devices: make(map[string]*Device), DBKey: testDBKey, Threshold: 5}
+	if err := server.InitDB(dbPath); err != nil {
+		t.Fatalf("InitDB failed on legacy schema: %v", err)
+	}
+	defer server.Db.Close()
+
+	if err := server.LoadDevices(); err != nil {
+		t.Fatalf("LoadDevices failed: %v", err)
+	}
+	device, exists := server.Devices["192.168.1.1"]
+	if !exists {
+		t.Fatalf("Expected legacy device to be loaded")
+	}
+	if device.CurrentCount != 7 || device.TotalCount != 70 || device.Threshold != 0 {
+		t.Errorf("Unexpected legacy device: %+v", device)
+	}
+	if device.RegisteredAt.Year() != 2024 {
+		t.Errorf("Expected legacy registration date to be kept, got %v", device.RegisteredAt)
+	}
+}
@@ -0,0 +1,211 @@
+package core_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "svrn.com/pluto/core"
+)
+
+// startTLSServer serves the handler of server with its own TLS configuration and returns the base URL
+func startTLSServer(t *testing.T, server *PlutoServer) string {
+	t.Helper()
+
+	config, err := server.TLSConfig()
+	if err != nil {
+		t.Fatalf("TLSConfig failed: %v", err)
+	}
+
+	// httptest.Server.StartTLS would add its own certificate, the listener is wrapped instead
+	httpServer := httptest.NewUnstartedServer(server.HTTPHandler())
+	httpServer.Listener = tls.NewListener(httpServer.Listener, config)
+	httpServer.Start()
+	t.Cleanup(httpServer.Close)
+	return "https://" + httpServer.Listener.Addr().String()
+}
+
+// trusting returns a client that trusts the certificates of a PEM file and presents clientCerts
+func trusting(t *testing.T, caFile string, clientCerts ...tls.Certificate) *http.Client {
+	t.Helper()
+
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(data)
+	return &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: clientCerts}},
+	}
+}
+
+func TestSelfSignedTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	server := newTestServer(t, "test_tls.db", 100)
+	server.TLS = TLSOptions{CertFile: certFile, KeyFile: keyFile, SelfSigned: true}
+	baseURL := startTLSServer(t, server)
+
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected a private key only readable by its owner, got %v", err)
+	}
+
+	first := servedCertificate(t, baseURL, certFile)
+
+	// A changed certificate is served from the next connection on without a restart
+	os.Remove(certFile)
+	os.Remove(keyFile)
+	if _, err := (&PlutoServer{TLS: server.TLS}).TLSConfig(); err != nil {
+		t.Fatalf("Failed to generate a new certificate: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+
+	second := servedCertificate(t, baseURL, certFile)
+	if first.SerialNumber.Cmp(second.SerialNumber) == 0 {
+		t.Error("Expected the regenerated certificate to be served")
+	}
+
+	// A broken replacement keeps the loaded certificate in service
+	secondFile := filepath.Join(dir, "second.pem")
+	if data, err := os.ReadFile(certFile); err != nil || os.WriteFile(secondFile, data, 0644) != nil {
+		t.Fatalf("Failed to keep a copy of the certificate: %v", err)
+	}
+	os.WriteFile(certFile, []byte("not a certificate"), 0644)
+	os.Chtimes(certFile, later.Add(time.Minute), later.Add(time.Minute))
+
+	if kept := servedCertificate(t, baseURL, secondFile); kept.SerialNumber.Cmp(second.SerialNumber) != 0 {
+		t.Error("Expected the loaded certificate to be kept")
+	}
+}
+
+// servedCertificate connects to url trusting certFile and returns the certificate the server presented
+func servedCertificate(t *testing.T, url, certFile string) *x509.Certificate {
+	t.Helper()
+
+	// New connections only, so each request performs a handshake
+	client := trusting(t, certFile)
+	client.Transport.(*http.Transport).DisableKeepAlives = true
+
+	resp, err := client.Get(url + "/ui/")
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	return resp.TLS.PeerCertificates[0]
+}
+
+func TestClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	caFile, clientCert := writeClientCertificate(t, dir)
+
+	server := newTestServer(t, "test_mtls.db", 100)
+	server.TLS = TLSOptions{CertFile: certFile, KeyFile: keyFile, SelfSigned: true, ClientCAFile: caFile}
+	baseURL := startTLSServer(t, server)
+
+	if _, err := trusting(t, certFile).Get(baseURL + "/ui/"); err == nil {
+		t.Error("Expected clients without a certificate to be refused")
+	}
+
+	req, _ := http.NewRequest("GET", baseURL+"/api/v1/devices", nil)
+	req.Header.Set("Authorization", "Bearer "+testTokens[server])
+	resp, err := trusting(t, certFile, clientCert).Do(req)
+	if err != nil {
+		t.Fatalf("Expected a client with a certificate to be accepted, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	// Optional verification lets clients without a certificate through to token authentication
+	server.TLS.ClientAuth = ClientAuthOptional
+	optional := startTLSServer(t, server)
+	resp, err = trusting(t, certFile).Get(optional + "/ui/")
+	if err != nil {
+		t.Fatalf("Expected a client without a certificate to be accepted, got %v", err)
+	}
+	resp.Body.Close()
+
+	server.TLS.ClientAuth = "sometimes"
+	if _, err := server.TLSConfig(); err == nil {
+		t.Error("Expected an unknown client auth mode to be rejected")
+	}
+
+	// Client certificate options never fall back to plain HTTP
+	server.TLS = TLSOptions{ClientCAFile: caFile}
+	if config, err := server.TLSConfig(); err == nil {
+		t.Errorf("Expected a client CA without TLS to be rejected, got %v", config)
+	}
+	server.TLS = TLSOptions{ClientAuth: ClientAuthOptional}
+	if config, err := server.TLSConfig(); err == nil {
+		t.Errorf("Expected a client auth mode without a client CA to be rejected, got %v", config)
+	}
+}
+
+func TestHTTPServerStartErrors(t *testing.T) {
+	server := newTestServer(t, "test_http_start.db", 100)
+
+	// A port in use is reported instead of leaving the server without its API
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to occupy a port: %v", err)
+	}
+	defer busy.Close()
+	if err := server.StartHTTPReloadServer(busy.Addr().(*net.TCPAddr).Port); err == nil {
+		t.Error("Expected an error for a port in use")
+	}
+
+	server.TLS = TLSOptions{CertFile: filepath.Join(t.TempDir(), "missing.pem"), KeyFile: "missing-key.pem"}
+	if err := server.StartHTTPReloadServer(0); err == nil {
+		t.Error("Expected an error for a missing certificate")
+	}
+}
+
+// writeClientCertificate writes a self-signed client certificate that serves as its own CA
+func writeClientCertificate(t *testing.T, dir string) (string, tls.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "automation"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create client certificate: %v", err)
+	}
+
+	caFile := filepath.Join(dir, "client-ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("Failed to write client CA: %v", err)
+	}
+	return caFile, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,84 @@
+package core_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestAPITokens(t *testing.T) {
+	server := newTestServer(t, "test_tokens.db", 100)
+
+	request := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		server.HTTPHandler().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request("POST", "/reload", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without a token, got %d", code)
+	}
+	if code := request("GET", "/api/v1/devices", "not-a-token"); code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for an unknown token, got %d", code)
+	}
+
+	token, issued, err := server.IssueToken("dashboard", RoleAdmin, nil)
+	if err != nil {
+		t.Fatalf("IssueToken failed: %v", err)
+	}
+	if len(token) != 64 || issued.Name != "dashboard" {
+		t.Errorf("Unexpected token %q: %+v", token, issued)
+	}
+	if _, _, err := server.IssueToken("dashboard", RoleAdmin, nil); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a duplicate name, got %v", err)
+	}
+	if _, _, err := server.IssueToken(" ", RoleViewer, nil); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput without a name, got %v", err)
+	}
+
+	if code := request("POST", "/reload", token); code != http.StatusOK {
+		t.Errorf("Expected status 200 with the token, got %d", code)
+	}
+
+	// Only the hash is stored
+	var stored int
+	server.Db.QueryRow("SELECT COUNT(*) FROM api_tokens WHERE hash = ?", token).Scan(&stored)
+	if stored != 0 {
+		t.Error("Expected the token not to be stored in plain text")
+	}
+
+	tokens, err := server.APITokens()
+	if err != nil {
+		t.Fatalf("APITokens failed: %v", err)
+	}
+	if len(tokens) != 2 || tokens[1].Name != "dashboard" || tokens[1].LastUsedAt == nil || tokens[1].RevokedAt != nil {
+		t.Errorf("Unexpected tokens: %+v", tokens)
+	}
+
+	if err := server.RevokeToken("dashboard"); err != nil {
+		t.Fatalf("RevokeToken failed: %v", err)
+	}
+	if err := server.RevokeToken("dashboard"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("Expected ErrTokenNotFound for a revoked token, got %v", err)
+	}
+	if code := request("POST", "/reload", token); code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 with a revoked token, got %d", code)
+	}
+
+	// A revoked name can be issued again
+	if _, _, err := server.IssueToken("dashboard", RoleAdmin, nil); err != nil {
+		t.Errorf("Expected a revoked name to be reusable, got %v", err)
+	}
+
+	// The dashboard files hold no data and load without a token
+	if code := request("GET", "/ui/", ""); code != http.StatusOK {
+		t.Errorf("Expected status 200 for the dashboard without a token, got %d", code)
+	}
+}
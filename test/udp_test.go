@@ -10,7 +10,6 @@ import (
 	"testing"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
 	. "svrn.com/pluto/core"
 )
 
@@ -21,12 +20,13 @@ func TestUDPServer(t *testing.T) {
 
 	server := &PlutoServer{
 		Devices:   make(map[string]*Device),
+		DBKey:     testDBKey,
 		Threshold: 5,
 	}
 
 	// Initialize database
 	var err error
-	server.Db, err = sql.Open("sqlite3", dbPath+"?_crypto_key="+PlutoDBPassword)
+	server.Db, err = sql.Open("sqlite3", testDSN(dbPath))
 	if err != nil {
 		t.Fatalf("Failed to open test database: %v", err)
 	}
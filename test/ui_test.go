@@ -0,0 +1,40 @@
+package core_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	server := newTestServer(t, "test_ui.db", 100)
+
+	w := doRequest(server, "GET", "/", nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/ui/" {
+		t.Fatalf("Expected a redirect to /ui/, got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+
+	pages := map[string]string{
+		"/ui/":            "Pluto.dashboard()",
+		"/ui/device.html": "Pluto.device(",
+		"/ui/app.js":      "/api/v1/devices",
+		"/ui/style.css":   ".progress",
+	}
+	for path, content := range pages {
+		w := doRequest(server, "GET", path, nil)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200 for %s, got %d", path, w.Code)
+			continue
+		}
+		if !strings.Contains(w.Body.String(), content) {
+			t.Errorf("Expected %s to contain %q", path, content)
+		}
+	}
+
+	if w := doRequest(server, "GET", "/ui/missing.html", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing file, got %d", w.Code)
+	}
+	if w := doRequest(server, "GET", "/unknown", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 outside the dashboard, got %d", w.Code)
+	}
+}
@@ -0,0 +1,112 @@
+package core_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	. "svrn.com/pluto/core"
+)
+
+func TestWorkOrderLifecycle(t *testing.T) {
+	server := newTestServer(t, "test_workorder.db", 5)
+
+	server.HandleStartup("192.168.1.1")
+	server.HandleCountIncrement("192.168.1.1", 3)
+	if orders, _ := server.WorkOrders("", ""); len(orders) != 0 {
+		t.Fatalf("Expected no work orders below threshold, got %d", len(orders))
+	}
+
+	// Crossing the threshold opens exactly one order, further increments do not open more
+	server.HandleCountIncrement("192.168.1.1", 3)
+	server.HandleCountIncrement("192.168.1.1", 3)
+
+	w := doRequest(server, "GET", "/work-orders?status=open", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var orders []WorkOrder
+	if err := json.Unmarshal(w.Body.Bytes(), &orders); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(orders) != 1 {
+		t.Fatalf("Expected 1 open work order, got %d", len(orders))
+	}
+	order := orders[0]
+	if order.DeviceIP != "192.168.1.1" || order.CountAtOpen != 6 {
+		t.Errorf("Unexpected work order: %+v", order)
+	}
+
+	path := fmt.Sprintf("/work-orders/%d", order.ID)
+
+	// Completing an open order skips the lifecycle
+	w = doRequest(server, "POST", path+"/complete", []byte(`{"technician": "Ayse"}`))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 completing an open order, got %d", w.Code)
+	}
+
+	steps := []struct {
+		action string
+		body   string
+		status string
+	}{
+		{"assign", `{"assignee": "Ayse"}`, WorkOrderAssigned},
+		{"start", ``, WorkOrderInProgress},
+		{"complete", `{"kind": "repair", "notes": "replaced optics"}`, WorkOrderCompleted},
+	}
+	for _, step := range steps {
+		w = doRequest(server, "POST", path+"/"+step.action, []byte(step.body))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", step.action, w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if order.Status != step.status {
+			t.Errorf("%s: expected status %s, got %s", step.action, step.status, order.Status)
+		}
+	}
+
+	if order.MaintenanceID == 0 {
+		t.Errorf("Expected completed order to reference its maintenance record")
+	}
+
+	device, _ := server.DeviceSnapshot("192.168.1.1")
+	if device.CurrentCount != 0 || device.TotalCount != 9 {
+		t.Errorf("Expected current=0 total=9 after completion, got current=%d total=%d", device.CurrentCount, device.TotalCount)
+	}
+
+	history, err := server.MaintenanceHistory("192.168.1.1")
+	if err != nil || len(history) != 1 {
+		t.Fatalf("Expected 1 maintenance record, got %d (%v)", len(history), err)
+	}
+	if history[0].Technician != "Ayse" || history[0].CountAtReset != 9 {
+		t.Errorf("Unexpected maintenance record: %+v", history[0])
+	}
+
+	// A new crossing after maintenance opens a new order
+	server.HandleCountIncrement("192.168.1.1", 5)
+	if orders, _ := server.WorkOrders(WorkOrderOpen, "192.168.1.1"); len(orders) != 1 {
+		t.Errorf("Expected a new open work order, got %d", len(orders))
+	}
+
+	w = doRequest(server, "GET", "/work-orders/999", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown work order, got %d", w.Code)
+	}
+}
+
+func TestMaintenanceCompletesActiveWorkOrder(t *testing.T) {
+	server := newTestServer(t, "test_workorder_direct.db", 5)
+
+	server.HandleCountIncrement("192.168.1.1", 5)
+	if _, err := server.RecordMaintenance("192.168.1.1", MaintenanceRecord{Technician: "Ayse"}); err != nil {
+		t.Fatalf("RecordMaintenance failed: %v", err)
+	}
+
+	orders, err := server.WorkOrders(WorkOrderCompleted, "192.168.1.1")
+	if err != nil || len(orders) != 1 {
+		t.Fatalf("Expected the work order to be completed by direct maintenance, got %d (%v)", len(orders), err)
+	}
+}